@@ -143,62 +143,91 @@ func TestClusterComplexTopology(t *testing.T) {
 func TestClusterSlotSet(t *testing.T) {
 	ctx := context.Background()
 
-	srv1 := util.StartServer(t, map[string]string{"cluster-enabled": "yes"})
-	defer srv1.Close()
-	rdb1 := srv1.NewClient()
-	defer func() { require.NoError(t, rdb1.Close()) }()
-	nodeID1 := "07c37dfeb235213a872192d90877d0cd55635b91"
-	require.NoError(t, rdb1.Do(ctx, "clusterx", "SETNODEID", nodeID1).Err())
-
-	srv2 := util.StartServer(t, map[string]string{"cluster-enabled": "yes"})
-	defer srv2.Close()
-	rdb2 := srv2.NewClient()
-	defer func() { require.NoError(t, rdb2.Close()) }()
-	nodeID2 := "07c37dfeb235213a872192d90877d0cd55635b92"
-	require.NoError(t, rdb2.Do(ctx, "clusterx", "SETNODEID", nodeID2).Err())
-
-	clusterNodes := fmt.Sprintf("%s %s %d master - 0-16383\n", nodeID1, srv1.Host(), srv1.Port())
-	clusterNodes += fmt.Sprintf("%s %s %d master -", nodeID2, srv2.Host(), srv2.Port())
-	require.NoError(t, rdb2.Do(ctx, "clusterx", "SETNODES", clusterNodes, "2").Err())
-	require.NoError(t, rdb1.Do(ctx, "clusterx", "SETNODES", clusterNodes, "2").Err())
+	cluster := util.StartCluster(t, util.ClusterSpec{
+		Shards:     2,
+		SlotLayout: [][]util.SlotRange{{{Start: 0, Stop: 16383}}, {}},
+	})
+	defer cluster.Close()
+	node1, node2 := cluster.Master(0), cluster.Master(1)
+	rdb1, rdb2 := node1.Client, node2.Client
 
 	slotKey := util.SlotTable[0]
 	require.NoError(t, rdb1.Set(ctx, slotKey, 0, 0).Err())
-	util.ErrorRegexp(t, rdb2.Set(ctx, slotKey, 0, 0).Err(), fmt.Sprintf(".*MOVED 0.*%d.*", srv1.Port()))
+	util.ErrorRegexp(t, rdb2.Set(ctx, slotKey, 0, 0).Err(), fmt.Sprintf(".*MOVED 0.*%d.*", node1.Server.Port()))
 
-	require.NoError(t, rdb2.Do(ctx, "clusterx", "setslot", "0", "node", nodeID2, "3").Err())
-	require.NoError(t, rdb1.Do(ctx, "clusterx", "setslot", "0", "node", nodeID2, "3").Err())
-	require.EqualValues(t, "3", rdb2.Do(ctx, "clusterx", "version").Val())
-	require.EqualValues(t, "3", rdb1.Do(ctx, "clusterx", "version").Val())
+	cluster.MoveSlots(util.SlotRange{Start: 0, Stop: 0}, node2)
+	require.EqualValues(t, 2, cluster.Version())
 	slots := rdb2.ClusterSlots(ctx).Val()
-	require.EqualValues(t, slots, rdb1.ClusterSlots(ctx).Val())
 	require.Len(t, slots, 2)
 	require.EqualValues(t, 0, slots[0].Start)
 	require.EqualValues(t, 0, slots[0].End)
-	require.EqualValues(t, []redis.ClusterNode{{ID: nodeID2, Addr: srv2.HostPort()}}, slots[0].Nodes)
+	require.EqualValues(t, []redis.ClusterNode{{ID: node2.ID, Addr: node2.Server.HostPort()}}, slots[0].Nodes)
 	require.EqualValues(t, 1, slots[1].Start)
 	require.EqualValues(t, 16383, slots[1].End)
-	require.EqualValues(t, []redis.ClusterNode{{ID: nodeID1, Addr: srv1.HostPort()}}, slots[1].Nodes)
+	require.EqualValues(t, []redis.ClusterNode{{ID: node1.ID, Addr: node1.Server.HostPort()}}, slots[1].Nodes)
 
 	require.NoError(t, rdb2.Set(ctx, slotKey, 0, 0).Err())
-	util.ErrorRegexp(t, rdb1.Set(ctx, slotKey, 0, 0).Err(), fmt.Sprintf(".*MOVED 0.*%d.*", srv2.Port()))
-	require.NoError(t, rdb2.Do(ctx, "clusterx", "setslot", "1", "node", nodeID2, "4").Err())
-	require.NoError(t, rdb1.Do(ctx, "clusterx", "setslot", "1", "node", nodeID2, "4").Err())
-	slots = rdb2.ClusterSlots(ctx).Val()
-	require.EqualValues(t, slots, rdb1.ClusterSlots(ctx).Val())
-	require.Len(t, slots, 2)
-	require.EqualValues(t, 0, slots[0].Start)
-	require.EqualValues(t, 1, slots[0].End)
-	require.EqualValues(t, []redis.ClusterNode{{ID: nodeID2, Addr: srv2.HostPort()}}, slots[0].Nodes)
-	require.EqualValues(t, 2, slots[1].Start)
-	require.EqualValues(t, 16383, slots[1].End)
-	require.EqualValues(t, []redis.ClusterNode{{ID: nodeID1, Addr: srv1.HostPort()}}, slots[1].Nodes)
+	util.ErrorRegexp(t, rdb1.Set(ctx, slotKey, 0, 0).Err(), fmt.Sprintf(".*MOVED 0.*%d.*", node2.Server.Port()))
+	cluster.MoveSlots(util.SlotRange{Start: 1, Stop: 1}, node2)
+	require.EqualValues(t, []util.SlotRange{{Start: 0, Stop: 1}}, node2.Slots())
+	require.EqualValues(t, []util.SlotRange{{Start: 2, Stop: 16383}}, node1.Slots())
 
 	// wrong version can't update slot distribution
-	require.ErrorContains(t, rdb2.Do(ctx, "clusterx", "setslot", "2", "node", nodeID2, "6").Err(), "version")
-	require.ErrorContains(t, rdb2.Do(ctx, "clusterx", "setslot", "2", "node", nodeID2, "4").Err(), "version")
-	require.EqualValues(t, "4", rdb2.Do(ctx, "clusterx", "version").Val())
-	require.EqualValues(t, "4", rdb1.Do(ctx, "clusterx", "version").Val())
+	version := cluster.Version()
+	require.ErrorContains(t, rdb2.Do(ctx, "clusterx", "setslot", "2", "node", node2.ID, version+2).Err(), "version")
+	require.ErrorContains(t, rdb2.Do(ctx, "clusterx", "setslot", "2", "node", node2.ID, version).Err(), "version")
+	cluster.RequireConverged()
+}
+
+func TestClusterTopologyChange(t *testing.T) {
+	ctx := context.Background()
+
+	cluster := util.StartCluster(t, util.ClusterSpec{Shards: 2, ReplicasPerShard: 1})
+	defer cluster.Close()
+	cluster.RequireConverged()
+	master0, master1 := cluster.Master(0), cluster.Master(1)
+
+	t.Run("move a slot range between shards", func(t *testing.T) {
+		cluster.MoveSlots(util.SlotRange{Start: 0, Stop: 99}, master1)
+		require.EqualValues(t, []util.SlotRange{{Start: 100, Stop: 8191}}, master0.Slots())
+		require.EqualValues(t, []util.SlotRange{{Start: 0, Stop: 99}, {Start: 8192, Stop: 16383}}, master1.Slots())
+		require.NoError(t, master1.Client.Set(ctx, util.SlotTable[0], "v", 0).Err())
+		util.ErrorRegexp(t, master0.Client.Get(ctx, util.SlotTable[0]).Err(), fmt.Sprintf(".*MOVED 0.*%d.*", master1.Server.Port()))
+	})
+
+	t.Run("add and remove a master", func(t *testing.T) {
+		node := cluster.AddNode(nil)
+		require.True(t, node.IsMaster())
+		require.Equal(t, 2, node.Shard)
+		cluster.MoveSlots(util.SlotRange{Start: 16383, Stop: 16383}, node)
+		require.NoError(t, node.Client.Set(ctx, util.SlotTable[16383], "v", 0).Err())
+		cluster.MoveSlots(util.SlotRange{Start: 16383, Stop: 16383}, master1)
+		cluster.RemoveNode(node)
+		require.Len(t, cluster.Nodes(), 4)
+	})
+
+	t.Run("add and remove a replica", func(t *testing.T) {
+		replica := cluster.AddNode(master0)
+		require.Len(t, cluster.Replicas(0), 2)
+		cluster.RemoveNode(replica)
+		require.Len(t, cluster.Replicas(0), 1)
+	})
+
+	t.Run("promote a replica", func(t *testing.T) {
+		require.NoError(t, master0.Client.Set(ctx, util.SlotTable[100], "v", 0).Err())
+		replica := cluster.Replicas(0)[0]
+		util.WaitForOffsetSync(t, master0.Client, replica.Client)
+
+		cluster.PromoteReplica(replica)
+		require.Equal(t, replica, cluster.Master(0))
+		require.Equal(t, replica, master0.Master)
+		require.EqualValues(t, []util.SlotRange{{Start: 100, Stop: 8191}}, replica.Slots())
+		require.Equal(t, "v", replica.Client.Get(ctx, util.SlotTable[100]).Val())
+		require.NoError(t, replica.Client.Set(ctx, util.SlotTable[100], "v2", 0).Err())
+		util.WaitForSync(t, master0.Client)
+		util.WaitForOffsetSync(t, replica.Client, master0.Client)
+		require.Equal(t, "v2", master0.Client.Get(ctx, util.SlotTable[100]).Val())
+	})
 }
 
 func TestClusterMultiple(t *testing.T) {
@@ -0,0 +1,125 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package durability
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/apache/incubator-kvrocks/tests/gocase/util"
+	"github.com/stretchr/testify/require"
+)
+
+func keys(prefix string, n int) []string {
+	ks := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		ks = append(ks, fmt.Sprintf("%s%d", prefix, i))
+	}
+	return ks
+}
+
+func TestCrashRestart(t *testing.T) {
+	ctx := context.Background()
+
+	for _, sync := range []string{"no", "yes"} {
+		t.Run("Acknowledged writes survive a crash with sync "+sync, func(t *testing.T) {
+			srv := util.StartServer(t, map[string]string{"rocksdb.write_options.sync": sync})
+			defer srv.Close()
+			rdb := srv.NewClient()
+			defer func() { require.NoError(t, rdb.Close()) }()
+
+			util.Populate(t, rdb, "key:", 1000, 16)
+			srv.CrashRestart()
+			require.EqualValues(t, 1000, rdb.Exists(ctx, keys("key:", 1000)...).Val())
+		})
+	}
+
+	t.Run("Writes without WAL survive a graceful restart but not a crash", func(t *testing.T) {
+		srv := util.StartServer(t, map[string]string{"rocksdb.write_options.disable_wal": "yes"})
+		defer srv.Close()
+		rdb := srv.NewClient()
+		defer func() { require.NoError(t, rdb.Close()) }()
+
+		// the memtables are flushed on shutdown since their content isn't in the WAL
+		util.Populate(t, rdb, "graceful:", 100, 16)
+		srv.Restart()
+		require.EqualValues(t, 100, rdb.Exists(ctx, keys("graceful:", 100)...).Val())
+
+		util.Populate(t, rdb, "crash:", 100, 16)
+		srv.CrashRestart()
+		require.EqualValues(t, 0, rdb.Exists(ctx, keys("crash:", 100)...).Val())
+		require.EqualValues(t, 100, rdb.Exists(ctx, keys("graceful:", 100)...).Val())
+	})
+
+	t.Run("WaitExit reports the exit of SHUTDOWN", func(t *testing.T) {
+		srv := util.StartServer(t, map[string]string{})
+		defer srv.Close()
+		rdb := srv.NewClient()
+		defer func() { require.NoError(t, rdb.Close()) }()
+
+		// the server may close the connection before replying
+		rdb.Shutdown(ctx)
+		require.Equal(t, util.ExitStatus{Code: 0}, srv.WaitExit())
+	})
+}
+
+// TestCrashRestartPartialSync crashes the master while its slave misses some writes. After the
+// restart, the master only has the WAL the slave needs to catch up if it was kept by the WAL TTL.
+func TestCrashRestartPartialSync(t *testing.T) {
+	ctx := context.Background()
+
+	for _, c := range []struct {
+		ttl      string
+		syncInfo string
+	}{
+		{"3600", "sync_partial_ok"},
+		{"0", "sync_full"},
+	} {
+		t.Run(fmt.Sprintf("WAL TTL of %s seconds", c.ttl), func(t *testing.T) {
+			master := util.StartServer(t, map[string]string{"rocksdb.wal_ttl_seconds": c.ttl, "rocksdb.wal_size_limit_mb": "0"})
+			defer master.Close()
+			masterClient := master.NewClient()
+			defer func() { require.NoError(t, masterClient.Close()) }()
+			slave := util.StartServer(t, map[string]string{})
+			defer slave.Close()
+			slaveClient := slave.NewClient()
+			defer func() { require.NoError(t, slaveClient.Close()) }()
+
+			util.SlaveOf(t, slaveClient, master)
+			util.WaitForSync(t, slaveClient)
+			util.Populate(t, masterClient, "before:", 100, 16)
+			util.WaitForOffsetSync(t, masterClient, slaveClient)
+
+			slave.Pause()
+			util.Populate(t, masterClient, "after:", 100, 16)
+			master.CrashRestart()
+			slave.Resume()
+
+			require.Eventually(t, func() bool {
+				return util.FindInfoEntry(masterClient, c.syncInfo) == "1"
+			}, 30*time.Second, 100*time.Millisecond)
+			util.WaitForOffsetSync(t, masterClient, slaveClient)
+			require.EqualValues(t, 100, slaveClient.Exists(ctx, keys("before:", 100)...).Val())
+			require.EqualValues(t, 100, slaveClient.Exists(ctx, keys("after:", 100)...).Val())
+		})
+	}
+}
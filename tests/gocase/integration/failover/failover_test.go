@@ -0,0 +1,297 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package failover
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/incubator-kvrocks/tests/gocase/util"
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+type node struct {
+	srv *util.KvrocksServer
+	// admin is only used while the node is running, and client, with short timeouts and
+	// no retries, by the workload which may hit a killed or paused node
+	admin, client *redis.Client
+}
+
+type write struct {
+	key   string
+	round int
+	ack   time.Time
+}
+
+type offsetSample struct {
+	round  int
+	call   time.Time
+	offset int64
+}
+
+// workload writes unique keys to the current master from concurrent clients, and samples
+// the master_repl_offset of the master. A round is the time a master is written to.
+type workload struct {
+	mu      sync.Mutex
+	round   int
+	master  *redis.Client
+	writes  []write
+	samples []offsetSample
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func (w *workload) current() (int, *redis.Client) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.round, w.master
+}
+
+// failover starts the next round on the new master.
+func (w *workload) failover(master *redis.Client) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.round++
+	w.master = master
+}
+
+func (w *workload) start(writers int) {
+	ctx := context.Background()
+	for i := 0; i < writers; i++ {
+		w.wg.Add(1)
+		go func(writer int) {
+			defer w.wg.Done()
+			for n := 0; ; n++ {
+				select {
+				case <-w.stop:
+					return
+				default:
+				}
+				round, c := w.current()
+				key := fmt.Sprintf("failover:%d:%d", writer, n)
+				if err := c.Set(ctx, key, key, 0).Err(); err != nil {
+					// the write may or may not have been applied
+					time.Sleep(10 * time.Millisecond)
+					continue
+				}
+				w.mu.Lock()
+				w.writes = append(w.writes, write{key, round, time.Now()})
+				w.mu.Unlock()
+			}
+		}(i)
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			round, c := w.current()
+			call := time.Now()
+			if offset, err := replOffset(c); err == nil {
+				w.mu.Lock()
+				w.samples = append(w.samples, offsetSample{round, call, offset})
+				w.mu.Unlock()
+			}
+		}
+	}()
+}
+
+func replOffset(c *redis.Client) (int64, error) {
+	return strconv.ParseInt(util.FindInfoEntry(c, "master_repl_offset"), 10, 64)
+}
+
+func waitForOffset(t testing.TB, c *redis.Client, offset int64) {
+	require.Eventually(t, func() bool {
+		o, err := replOffset(c)
+		return err == nil && o >= offset
+	}, 30*time.Second, 100*time.Millisecond)
+}
+
+// TestFailoverAcknowledgedWrites kills or pauses the master while it's written to, promotes its most
+// up to date replica with SLAVEOF NO ONE and repoints the other nodes to it, a few times in a row.
+// Replication is asynchronous, so acknowledged writes may be lost, but only those in the loss window:
+// a write is acknowledged once it's applied on the master, so an offset sampled on the master after
+// the acknowledgement covers the write, and the write must survive if the promoted replica reached
+// that offset.
+func TestFailoverAcknowledgedWrites(t *testing.T) {
+	util.SeedRandom(t)
+	ctx := context.Background()
+
+	var nodes []*node
+	for i := 0; i < 3; i++ {
+		srv := util.StartServer(t, map[string]string{"use-rsid-psync": "yes"})
+		defer srv.Close()
+		n := &node{
+			srv:    srv,
+			admin:  srv.NewClient(),
+			client: srv.NewClientWithOption(&redis.Options{ReadTimeout: 500 * time.Millisecond, WriteTimeout: 500 * time.Millisecond, MaxRetries: -1}),
+		}
+		defer func() {
+			require.NoError(t, n.client.Close())
+			require.NoError(t, n.admin.Close())
+		}()
+		nodes = append(nodes, n)
+	}
+	master, replicas := nodes[0], nodes[1:]
+	for _, r := range replicas {
+		util.SlaveOf(t, r.admin, master.srv)
+		util.WaitForSync(t, r.admin)
+	}
+
+	w := &workload{master: master.client, stop: make(chan struct{})}
+	w.start(8)
+	defer func() {
+		select {
+		case <-w.stop:
+		default:
+			close(w.stop)
+			w.wg.Wait()
+		}
+	}()
+
+	const rounds = 4
+	// promoted is the offset of the replica promoted at the end of each round, the last
+	// master never fails
+	promoted := make([]int64, rounds+1)
+	promoted[rounds] = math.MaxInt64
+	killed := make([]bool, rounds)
+	for round := 0; round < rounds; round++ {
+		time.Sleep(time.Second)
+
+		killed[round] = util.RandomBool()
+		if killed[round] {
+			master.srv.Kill()
+		} else {
+			master.srv.Pause()
+		}
+
+		// the replicas don't receive anything from the failed master anymore
+		offsets := make([]int64, len(replicas))
+		for i, r := range replicas {
+			o, err := replOffset(r.admin)
+			require.NoError(t, err)
+			offsets[i] = o
+		}
+		if offsets[1] > offsets[0] {
+			replicas[0], replicas[1] = replicas[1], replicas[0]
+			offsets[0], offsets[1] = offsets[1], offsets[0]
+		}
+		newMaster, other, old := replicas[0], replicas[1], master
+		promoted[round] = offsets[0]
+		require.NoError(t, newMaster.admin.SlaveOf(ctx, "NO", "ONE").Err())
+		w.failover(newMaster.client)
+
+		util.SlaveOf(t, other.admin, newMaster.srv)
+		if killed[round] {
+			old.srv.Restart()
+		} else {
+			old.srv.Resume()
+		}
+		util.SlaveOf(t, old.admin, newMaster.srv)
+		// all the nodes have the writes which survived so far before the next failure
+		for _, r := range []*node{other, old} {
+			waitForOffset(t, r.admin, promoted[round])
+		}
+		master, replicas = newMaster, []*node{other, old}
+	}
+	time.Sleep(time.Second)
+	close(w.stop)
+	w.wg.Wait()
+
+	// covered returns the offset of the first sample of the master taken after the write
+	// was acknowledged, if any, the samples are taken one after another so they are sorted
+	// by time and round
+	covered := func(wr write) (int64, bool) {
+		i := sort.Search(len(w.samples), func(i int) bool {
+			s := w.samples[i]
+			return s.round > wr.round || (s.round == wr.round && !s.call.Before(wr.ack))
+		})
+		if i == len(w.samples) || w.samples[i].round != wr.round {
+			return 0, false
+		}
+		return w.samples[i].offset, true
+	}
+	lastOffsets := make([]int64, rounds+1)
+	for _, s := range w.samples {
+		lastOffsets[s.round] = s.offset
+	}
+
+	acked := make([]int, rounds+1)
+	inWindow := make([]int, rounds+1)
+	lost := make([]int, rounds+1)
+	var violations []string
+	for i := 0; i < len(w.writes); i += 1000 {
+		end := i + 1000
+		if end > len(w.writes) {
+			end = len(w.writes)
+		}
+		batch := w.writes[i:end]
+		keys := make([]string, 0, len(batch))
+		for _, wr := range batch {
+			keys = append(keys, wr.key)
+		}
+		values, err := master.admin.MGet(ctx, keys...).Result()
+		require.NoError(t, err)
+		for j, wr := range batch {
+			acked[wr.round]++
+			offset, ok := covered(wr)
+			guaranteed := wr.round == rounds || (ok && offset <= promoted[wr.round])
+			if !guaranteed {
+				inWindow[wr.round]++
+			}
+			if values[j] == nil {
+				lost[wr.round]++
+				if guaranteed {
+					violations = append(violations, fmt.Sprintf("%s acknowledged in round %d at offset %d", wr.key, wr.round, offset))
+				}
+				continue
+			}
+			require.Equal(t, wr.key, values[j])
+		}
+	}
+	for round := 0; round < rounds; round++ {
+		failure := "paused"
+		if killed[round] {
+			failure = "killed"
+		}
+		window := lastOffsets[round] - promoted[round]
+		if window < 0 {
+			window = 0
+		}
+		t.Logf("round %d: master %s at offset %d, replica promoted at offset %d, loss window of %d sequences, "+
+			"%d acknowledged writes of which %d in the loss window and %d lost", round, failure, lastOffsets[round],
+			promoted[round], window, acked[round], inWindow[round], lost[round])
+	}
+	t.Logf("last round: %d acknowledged writes of which %d lost", acked[rounds], lost[rounds])
+	require.Empty(t, violations, "acknowledged writes lost outside of the loss window")
+}
@@ -237,9 +237,7 @@ func TestReplicationWithLimitSpeed(t *testing.T) {
 		masterClient = master.NewClient()
 
 		require.NoError(t, masterClient.ConfigSet(ctx, "max-replication-mb", "0").Err())
-		require.Eventually(t, func() bool {
-			return slave.LogFileMatches(t, ".*skip count: 1.*")
-		}, 50*time.Second, 1000*time.Millisecond)
+		slave.WaitForLog(t, util.LogInfo, "skip count: 1", 50*time.Second)
 		util.WaitForSync(t, slaveClient)
 		require.Equal(t, "b", slaveClient.Get(ctx, "a").Val())
 	})
@@ -272,9 +270,7 @@ func TestReplicationShareCheckpoint(t *testing.T) {
 		util.SlaveOf(t, slave1Client, master)
 		util.SlaveOf(t, slave2Client, master)
 
-		require.Eventually(t, func() bool {
-			return master.LogFileMatches(t, ".*Use current existing checkpoint.*")
-		}, 50*time.Second, 100*time.Millisecond)
+		master.WaitForLog(t, util.LogInfo, "Use current existing checkpoint", 50*time.Second)
 		util.WaitForSync(t, slave1Client)
 		util.WaitForSync(t, slave2Client)
 		require.Equal(t, "b", slave1Client.Get(ctx, "a").Val())
@@ -351,3 +347,140 @@ func TestReplicationChangePassword(t *testing.T) {
 		require.Contains(t, masterReplicationInfo, strconv.Itoa(int(slave.Port())))
 	})
 }
+
+func TestReplicationThroughFaultProxy(t *testing.T) {
+	master := util.StartServer(t, map[string]string{})
+	defer master.Close()
+	masterClient := master.NewClient()
+	defer func() { require.NoError(t, masterClient.Close()) }()
+
+	slave := util.StartServer(t, map[string]string{})
+	defer slave.Close()
+	slaveClient := slave.NewClient()
+	defer func() { require.NoError(t, slaveClient.Close()) }()
+
+	proxy := util.StartFaultProxy(t, master.HostPort())
+	defer proxy.Close()
+
+	util.SlaveOf(t, slaveClient, proxy)
+	util.WaitForSync(t, slaveClient)
+
+	ctx := context.Background()
+	t.Run("Replication stream is delayed by the latency of the link", func(t *testing.T) {
+		proxy.SetLatency(util.Downstream, 500*time.Millisecond, 100*time.Millisecond)
+		defer proxy.Heal()
+		require.NoError(t, masterClient.Set(ctx, "delayed", "1", 0).Err())
+		time.Sleep(100 * time.Millisecond)
+		require.Equal(t, "", slaveClient.Get(ctx, "delayed").Val())
+		util.WaitForOffsetSync(t, masterClient, slaveClient)
+		require.Equal(t, "1", slaveClient.Get(ctx, "delayed").Val())
+	})
+
+	t.Run("Replication stream is stalled by a blackhole", func(t *testing.T) {
+		proxy.Blackhole(util.Downstream, true)
+		defer proxy.Heal()
+		require.NoError(t, masterClient.Set(ctx, "stalled", "1", 0).Err())
+		time.Sleep(time.Second)
+		require.NotEqual(t, util.FindInfoEntry(masterClient, "master_repl_offset"), util.FindInfoEntry(slaveClient, "master_repl_offset"))
+		// the link is healed before the reset, the discarded stream can only be recovered by a new
+		// replication connection
+		proxy.Heal()
+		proxy.ResetConnections()
+		util.WaitForSync(t, slaveClient)
+		util.WaitForOffsetSync(t, masterClient, slaveClient)
+		require.Equal(t, "1", slaveClient.Get(ctx, "stalled").Val())
+	})
+
+	t.Run("Slave continues with partial sync after the connection is reset", func(t *testing.T) {
+		psync, err := strconv.Atoi(util.FindInfoEntry(masterClient, "sync_partial_ok"))
+		require.NoError(t, err)
+		proxy.ResetConnections()
+		require.NoError(t, masterClient.Set(ctx, "reset", "1", 0).Err())
+		require.Eventually(t, func() bool {
+			return util.FindInfoEntry(masterClient, "sync_partial_ok") == strconv.Itoa(psync+1)
+		}, 10*time.Second, 100*time.Millisecond)
+		util.WaitForOffsetSync(t, masterClient, slaveClient)
+		require.Equal(t, "1", slaveClient.Get(ctx, "reset").Val())
+	})
+}
+
+func TestReplicationPartition(t *testing.T) {
+	master := util.StartServer(t, map[string]string{})
+	defer master.Close()
+	masterClient := master.NewClient()
+	defer func() { require.NoError(t, masterClient.Close()) }()
+
+	slave := util.StartServer(t, map[string]string{})
+	defer slave.Close()
+	slaveClient := slave.NewClient()
+	defer func() { require.NoError(t, slaveClient.Close()) }()
+
+	network := util.NewNetwork(t)
+	defer network.Close()
+	network.SlaveOf(slave, slaveClient, master)
+	util.WaitForSync(t, slaveClient)
+
+	t.Run("Slave catches up with partial sync after the partition is healed", func(t *testing.T) {
+		ctx := context.Background()
+		fullSync := util.FindInfoEntry(masterClient, "sync_full")
+		psync, err := strconv.Atoi(util.FindInfoEntry(masterClient, "sync_partial_ok"))
+		require.NoError(t, err)
+
+		network.Partition([]*util.KvrocksServer{master}, []*util.KvrocksServer{slave})
+		require.True(t, network.IsPartitioned(slave, master))
+		util.Populate(t, masterClient, "partitioned", 100, 10)
+		time.Sleep(time.Second)
+		require.EqualValues(t, 0, slaveClient.Exists(ctx, "partitioned0").Val())
+
+		// the held connection would just resume, so it's cut for the slave to reconnect with PSYNC
+		network.Link(slave, master).ResetConnections()
+		network.Heal()
+		require.Eventually(t, func() bool {
+			return util.FindInfoEntry(masterClient, "sync_partial_ok") == strconv.Itoa(psync+1)
+		}, 10*time.Second, 100*time.Millisecond)
+		util.WaitForOffsetSync(t, masterClient, slaveClient)
+		require.EqualValues(t, 1, slaveClient.Exists(ctx, "partitioned99").Val())
+		require.Equal(t, fullSync, util.FindInfoEntry(masterClient, "sync_full"))
+	})
+}
+
+func TestReplicationLinearizability(t *testing.T) {
+	util.SeedRandom(t)
+	master := util.StartServer(t, map[string]string{})
+	defer master.Close()
+	masterClient := master.NewClient()
+	defer func() { require.NoError(t, masterClient.Close()) }()
+
+	var slaves []*util.KvrocksServer
+	var slaveClients []*redis.Client
+	for i := 0; i < 2; i++ {
+		slave := util.StartServer(t, map[string]string{})
+		defer slave.Close()
+		slaveClient := slave.NewClient()
+		defer func() { require.NoError(t, slaveClient.Close()) }()
+		util.SlaveOf(t, slaveClient, master)
+		util.WaitForSync(t, slaveClient)
+		slaves = append(slaves, slave)
+		slaveClients = append(slaveClients, slaveClient)
+	}
+
+	keys := []string{"lin-key-1", "lin-key-2", "lin-key-3"}
+	h := util.RegisterWorkload{Keys: keys, Clients: 20, Commands: 200, Replicas: slaves, ReplicaClients: 2}.Run(t, master)
+	util.RequireLinearizable(t, h.Operations())
+	util.RequireReplicaReads(t, h.Operations())
+
+	// once the slaves caught up, they have the last state of the master
+	ctx := context.Background()
+	for _, slaveClient := range slaveClients {
+		util.WaitForOffsetSync(t, masterClient, slaveClient)
+		for _, key := range keys {
+			expected, err := masterClient.Get(ctx, key).Result()
+			if err == redis.Nil {
+				require.Equal(t, redis.Nil, slaveClient.Get(ctx, key).Err(), key)
+				continue
+			}
+			require.NoError(t, err)
+			require.Equal(t, expected, slaveClient.Get(ctx, key).Val(), key)
+		}
+	}
+}
@@ -32,25 +32,13 @@ import (
 func TestImportSlaveServer(t *testing.T) {
 	ctx := context.Background()
 
-	srvA := util.StartServer(t, map[string]string{"cluster-enabled": "yes"})
-	defer func() { srvA.Close() }()
-	rdbA := srvA.NewClient()
-	defer func() { require.NoError(t, rdbA.Close()) }()
-	srvAID := "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx00"
-	require.NoError(t, rdbA.Do(ctx, "clusterx", "SETNODEID", srvAID).Err())
-
-	srvB := util.StartServer(t, map[string]string{"cluster-enabled": "yes"})
-	defer func() { srvB.Close() }()
-	rdbB := srvB.NewClient()
-	defer func() { require.NoError(t, rdbB.Close()) }()
-	srvBID := "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx01"
-	require.NoError(t, rdbB.Do(ctx, "clusterx", "SETNODEID", srvBID).Err())
-
-	clusterNodes := fmt.Sprintf("%s 127.0.0.1 %d master - 0-100", srvAID, srvA.Port())
-	clusterNodes = fmt.Sprintf("%s\n%s 127.0.0.1 %d slave %s", clusterNodes, srvBID, srvB.Port(), srvAID)
-
-	require.NoError(t, rdbA.Do(ctx, "clusterx", "SETNODES", clusterNodes, "1").Err())
-	require.NoError(t, rdbB.Do(ctx, "clusterx", "SETNODES", clusterNodes, "1").Err())
+	cluster := util.StartCluster(t, util.ClusterSpec{
+		Shards:           1,
+		ReplicasPerShard: 1,
+		SlotLayout:       [][]util.SlotRange{{{Start: 0, Stop: 100}}},
+	})
+	defer cluster.Close()
+	rdbB := cluster.Replicas(0)[0].Client
 
 	t.Run("IMPORT - Can't import slot to slave", func(t *testing.T) {
 		time.Sleep(100 * time.Millisecond)
@@ -36,24 +36,16 @@ import (
 func TestSlotMigrateFromSlave(t *testing.T) {
 	ctx := context.Background()
 
-	master := util.StartServer(t, map[string]string{"cluster-enabled": "yes"})
-	defer func() { master.Close() }()
-	masterClient := master.NewClient()
-	defer func() { require.NoError(t, masterClient.Close()) }()
-	masterID := "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx00"
-	require.NoError(t, masterClient.Do(ctx, "clusterx", "SETNODEID", masterID).Err())
-
-	slave := util.StartServer(t, map[string]string{"cluster-enabled": "yes"})
-	defer func() { slave.Close() }()
-	slaveClient := slave.NewClient()
-	defer func() { require.NoError(t, slaveClient.Close()) }()
-	slaveID := "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx01"
-	require.NoError(t, slaveClient.Do(ctx, "clusterx", "SETNODEID", slaveID).Err())
-
-	clusterNodes := fmt.Sprintf("%s %s %d master - 0-100\n", masterID, master.Host(), master.Port())
-	clusterNodes += fmt.Sprintf("%s %s %d slave %s", slaveID, slave.Host(), slave.Port(), masterID)
-	require.NoError(t, masterClient.Do(ctx, "clusterx", "SETNODES", clusterNodes, "1").Err())
-	require.NoError(t, slaveClient.Do(ctx, "clusterx", "SETNODES", clusterNodes, "1").Err())
+	cluster := util.StartCluster(t, util.ClusterSpec{
+		Shards:           1,
+		ReplicasPerShard: 1,
+		SlotLayout:       [][]util.SlotRange{{{Start: 0, Stop: 100}}},
+	})
+	defer cluster.Close()
+	master := cluster.Master(0)
+	masterClient, masterID := master.Client, master.ID
+	slave := cluster.Replicas(0)[0]
+	slaveClient, slaveID := slave.Client, slave.ID
 
 	t.Run("MIGRATE - Slave cannot migrate slot", func(t *testing.T) {
 		require.ErrorContains(t, slaveClient.Do(ctx, "clusterx", "migrate", "1", masterID).Err(), "Can't migrate slot")
@@ -75,12 +67,7 @@ func TestSlotMigrateDestServerKilled(t *testing.T) {
 	require.NoError(t, rdb0.Do(ctx, "clusterx", "SETNODEID", id0).Err())
 
 	srv1 := util.StartServer(t, map[string]string{"cluster-enabled": "yes"})
-	srv1Alive := true
-	defer func() {
-		if srv1Alive {
-			srv1.Close()
-		}
-	}()
+	defer func() { srv1.Close() }()
 	rdb1 := srv1.NewClient()
 	defer func() { require.NoError(t, rdb1.Close()) }()
 	id1 := "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx01"
@@ -101,8 +88,7 @@ func TestSlotMigrateDestServerKilled(t *testing.T) {
 	})
 
 	t.Run("MIGRATE - Fail to migrate slot if destination server is not running", func(t *testing.T) {
-		srv1.Close()
-		srv1Alive = false
+		srv1.Kill()
 		require.NoError(t, rdb0.Do(ctx, "clusterx", "migrate", "1", id1).Err())
 		time.Sleep(50 * time.Millisecond)
 		requireMigrateState(t, rdb0, "1", "fail")
@@ -120,12 +106,7 @@ func TestSlotMigrateDestServerKilledAgain(t *testing.T) {
 	require.NoError(t, rdb0.Do(ctx, "clusterx", "SETNODEID", id0).Err())
 
 	srv1 := util.StartServer(t, map[string]string{"cluster-enabled": "yes"})
-	srv1Alive := true
-	defer func() {
-		if srv1Alive {
-			srv1.Close()
-		}
-	}()
+	defer func() { srv1.Close() }()
 	rdb1 := srv1.NewClient()
 	defer func() { require.NoError(t, rdb1.Close()) }()
 	id1 := "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx01"
@@ -179,8 +160,7 @@ func TestSlotMigrateDestServerKilledAgain(t *testing.T) {
 		}
 		require.Equal(t, "OK", rdb0.Do(ctx, "clusterx", "migrate", "8", id1).Val())
 		requireMigrateState(t, rdb0, "8", "start")
-		srv1.Close()
-		srv1Alive = false
+		srv1.Kill()
 		time.Sleep(time.Second)
 		requireMigrateState(t, rdb0, "8", "fail")
 	})
@@ -190,12 +170,7 @@ func TestSlotMigrateSourceServerFlushedOrKilled(t *testing.T) {
 	ctx := context.Background()
 
 	srv0 := util.StartServer(t, map[string]string{"cluster-enabled": "yes"})
-	srv0Alive := true
-	defer func() {
-		if srv0Alive {
-			srv0.Close()
-		}
-	}()
+	defer func() { srv0.Close() }()
 	rdb0 := srv0.NewClient()
 	defer func() { require.NoError(t, rdb0.Close()) }()
 	id0 := "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx00"
@@ -237,8 +212,7 @@ func TestSlotMigrateSourceServerFlushedOrKilled(t *testing.T) {
 			return slices.Contains(rdb1.Keys(ctx, "*").Val(), util.SlotTable[20])
 		}, 5*time.Second, 100*time.Millisecond)
 
-		srv0.Close()
-		srv0Alive = false
+		srv0.Kill()
 		time.Sleep(100 * time.Millisecond)
 		require.NotContains(t, rdb1.Keys(ctx, "*").Val(), util.SlotTable[20])
 	})
@@ -695,6 +669,66 @@ func TestSlotMigrateDataType(t *testing.T) {
 	})
 }
 
+func TestSlotMigrateAcrossShards(t *testing.T) {
+	ctx := context.Background()
+
+	cluster := util.StartCluster(t, util.ClusterSpec{Shards: 3})
+	defer cluster.Close()
+
+	slot := 100
+	rdb := cluster.Master(0).Client
+	tag := util.SlotTable[slot]
+	require.NoError(t, rdb.Set(ctx, fmt.Sprintf("string_{%s}", tag), "value", time.Hour).Err())
+	require.NoError(t, rdb.HSet(ctx, fmt.Sprintf("hash_{%s}", tag), "f1", "v1", "f2", "v2").Err())
+	require.NoError(t, rdb.RPush(ctx, fmt.Sprintf("list_{%s}", tag), "a", "b", "c").Err())
+	require.NoError(t, rdb.SAdd(ctx, fmt.Sprintf("set_{%s}", tag), "a", "b", "c").Err())
+	require.NoError(t, rdb.ZAdd(ctx, fmt.Sprintf("zset_{%s}", tag), redis.Z{Score: 1, Member: "a"}, redis.Z{Score: 2, Member: "b"}).Err())
+	require.NoError(t, rdb.SetBit(ctx, fmt.Sprintf("bitmap_{%s}", tag), 1024, 1).Err())
+	require.NoError(t, rdb.Do(ctx, "SIADD", fmt.Sprintf("sortint_{%s}", tag), 1, 2, 3).Err())
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, rdb.LPush(ctx, fmt.Sprintf("biglist_{%s}", tag), i).Err())
+	}
+	digest := util.SlotDigest(t, rdb, slot)
+	require.Len(t, digest, 8)
+
+	for _, shard := range []int{1, 2, 0} {
+		m := cluster.MigrateSlot(slot, cluster.Master(shard))
+		require.Equal(t, util.MigrateSuccess, m.MigrateState())
+		require.Equal(t, util.ImportSuccess, m.ImportState())
+		require.Equal(t, digest, util.SlotDigest(t, cluster.Master(shard).Client, slot))
+	}
+}
+
+func TestSlotMigratePartitioned(t *testing.T) {
+	ctx := context.Background()
+
+	cluster := util.StartCluster(t, util.ClusterSpec{Shards: 2, Proxied: true})
+	defer cluster.Close()
+	cluster.RequireConverged()
+	src, dst := cluster.Master(0), cluster.Master(1)
+
+	slot := 10
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, src.Client.LPush(ctx, util.SlotTable[slot], i).Err())
+	}
+
+	t.Run("MIGRATE - Fail to migrate slot if destination is partitioned", func(t *testing.T) {
+		cluster.Partition([]*util.ClusterNode{src}, []*util.ClusterNode{dst})
+		m := cluster.StartMigration(slot, dst)
+		require.Equal(t, util.MigrateFail, m.Wait(30*time.Second))
+		require.EqualValues(t, 1000, src.Client.LLen(ctx, util.SlotTable[slot]).Val())
+
+		// drop the data held by the broken connection instead of delivering it after healing
+		cluster.Network().Link(src.Server, dst.Server).ResetConnections()
+		cluster.Heal()
+	})
+
+	t.Run("MIGRATE - Migrate slot after the partition is healed", func(t *testing.T) {
+		cluster.MigrateSlot(slot, dst)
+		require.EqualValues(t, 1000, dst.Client.LLen(ctx, util.SlotTable[slot]).Val())
+	})
+}
+
 func waitForMigrateState(t testing.TB, client *redis.Client, n, state string) {
 	waitForMigrateStateInDuration(t, client, n, state, 5*time.Second)
 }
@@ -0,0 +1,132 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package command
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/incubator-kvrocks/tests/gocase/util"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slices"
+)
+
+// A command taking longer than this is considered as hanging.
+const commandLatencyLimit = 5 * time.Second
+
+// Commands which would stop the server, change its role or configuration, block,
+// run scripts, or switch the connection out of the request/reply protocol are not fuzzed.
+var unfuzzedCommands = []string{
+	"shutdown", "debug", "slaveof", "config", "namespace", "cluster", "clusterx",
+	"monitor", "quit", "client", "multi", "exec", "discard",
+	"subscribe", "unsubscribe", "psubscribe", "punsubscribe",
+	"blpop", "brpop", "eval", "evalsha", "eval_ro", "evalsha_ro", "script",
+	"compact", "bgsave", "flushbackup", "replconf", "psync", "_fetch_meta", "_fetch_file", "_db_name",
+}
+
+// The documented error replies start with one of these codes.
+var errorCodes = []string{"ERR", "WRONGTYPE", "NOAUTH", "LOADING", "READONLY", "MASTERDOWN", "EXECABORT", "NOSCRIPT"}
+
+// Error replies without an error code which are known to be sent by the fuzzed commands.
+var knownErrorForms = []*regexp.Regexp{
+	regexp.MustCompile(`^object subcommand must be dump$`),
+	regexp.MustCompile(`^DBSIZE subcommand only supports scan$`),
+	regexp.MustCompile(`^Invalid arguments specified for command$`),
+	regexp.MustCompile(`^Command subcommand must be one of COUNT, GETKEYS, INFO$`),
+	regexp.MustCompile(`^Syntax error in HELLO option `),
+}
+
+func isDocumentedError(msg string) bool {
+	code, _, _ := strings.Cut(msg, " ")
+	if slices.Contains(errorCodes, code) {
+		return true
+	}
+	for _, form := range knownErrorForms {
+		if form.MatchString(msg) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCommandFuzz(t *testing.T) {
+	util.SeedRandom(t)
+	srv := util.StartServer(t, map[string]string{})
+	defer srv.Close()
+
+	rdb := srv.NewClient()
+	defer func() { require.NoError(t, rdb.Close()) }()
+
+	var commands []util.CommandInfo
+	for _, cmd := range util.CommandTable(t, rdb) {
+		if !slices.Contains(unfuzzedCommands, cmd.Name) {
+			commands = append(commands, cmd)
+		}
+	}
+	require.NotEmpty(t, commands)
+
+	c := srv.NewTCPClient()
+	defer func() { require.NoError(t, c.Close()) }()
+
+	fuzzer := util.NewCommandFuzzer("fuzz")
+	iterations := 5000
+	if testing.Short() {
+		iterations = 500
+	}
+
+	// the last commands are reported to reproduce a crash or a hang, since they may depend on the state
+	var history []string
+	undocumented := make(map[string]string)
+	for i := 0; i < iterations; i++ {
+		if i%100 == 0 {
+			fuzzer.Populate(t, rdb)
+		}
+		args := fuzzer.Args(commands[rand.Intn(len(commands))])
+		history = append(history, fmt.Sprintf("%q", args))
+		if len(history) > 20 {
+			history = history[1:]
+		}
+
+		require.NoError(t, c.WriteArgs(args...))
+		require.NoError(t, c.SetReadDeadline(time.Now().Add(commandLatencyLimit)))
+		r, err := c.ReadReply()
+		require.False(t, srv.Exited(), "server crashed, the last commands:\n%s", strings.Join(history, "\n"))
+		var netErr net.Error
+		require.False(t, errors.As(err, &netErr) && netErr.Timeout(),
+			"no reply in %s, the last commands:\n%s", commandLatencyLimit, strings.Join(history, "\n"))
+		require.NoError(t, err, "malformed reply to %q", args)
+
+		if r.Type == util.ReplyError && !isDocumentedError(r.Str) {
+			if _, ok := undocumented[r.Str]; !ok {
+				undocumented[r.Str] = fmt.Sprintf("%q", args)
+			}
+		}
+	}
+
+	for msg, args := range undocumented {
+		t.Errorf("undocumented error reply %q to %s", msg, args)
+	}
+}
@@ -41,3 +41,40 @@ func TestRenameCommand(t *testing.T) {
 	r := rdb.Do(ctx, "KEYSNEW", "*")
 	require.Equal(t, []interface{}{}, r.Val())
 }
+
+func TestConfigRewriteAndRestart(t *testing.T) {
+	srv := util.StartServer(t, map[string]string{})
+	defer srv.Close()
+
+	ctx := context.Background()
+	rdb := srv.NewClient()
+	defer func() { require.NoError(t, rdb.Close()) }()
+	require.NoError(t, rdb.Set(ctx, "foo", "bar", 0).Err())
+
+	t.Run("CONFIG REWRITE persists the configuration set at runtime", func(t *testing.T) {
+		require.NoError(t, rdb.ConfigSet(ctx, "maxclients", "100").Err())
+		require.NoError(t, rdb.ConfigRewrite(ctx).Err())
+		configs := srv.ReadConfigFile(t)
+		require.Equal(t, "100", configs["maxclients"])
+		require.Equal(t, srv.Host(), configs["bind"])
+	})
+
+	t.Run("Restart with a modified configuration keeps the data", func(t *testing.T) {
+		srv.RestartWithConfig(map[string]string{"use-rsid-psync": "yes", "rocksdb.compression": "lz4"})
+		require.Equal(t, map[string]string{"use-rsid-psync": "yes"}, rdb.ConfigGet(ctx, "use-rsid-psync").Val())
+		require.Equal(t, map[string]string{"rocksdb.compression": "lz4"}, rdb.ConfigGet(ctx, "rocksdb.compression").Val())
+		require.Equal(t, map[string]string{"maxclients": "100"}, rdb.ConfigGet(ctx, "maxclients").Val())
+		require.Equal(t, "bar", rdb.Get(ctx, "foo").Val())
+
+		configs := srv.ReadConfigFile(t)
+		require.Equal(t, "yes", configs["use-rsid-psync"])
+		require.Equal(t, "lz4", configs["rocksdb.compression"])
+	})
+
+	t.Run("Restart without a key of the configuration uses its default", func(t *testing.T) {
+		srv.RestartWithConfig(map[string]string{"maxclients": ""})
+		require.NotContains(t, srv.ReadConfigFile(t), "maxclients")
+		require.Equal(t, map[string]string{"maxclients": "10240"}, rdb.ConfigGet(ctx, "maxclients").Val())
+		require.Equal(t, "bar", rdb.Get(ctx, "foo").Val())
+	})
+}
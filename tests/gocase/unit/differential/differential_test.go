@@ -0,0 +1,190 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package differential
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/apache/incubator-kvrocks/tests/gocase/util"
+)
+
+// The command streams are replayed against a redis-server given by `-redisServerPath`,
+// which should be at least 6.2 to support all generated commands.
+func TestDifferential(t *testing.T) {
+	util.SeedRandom(t)
+	rds := util.StartRedisServer(t)
+	defer rds.Close()
+	srv := util.StartServer(t, map[string]string{})
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		name    string
+		command func() []string
+	}{
+		{"strings", stringCommand},
+		{"hashes", hashCommand},
+		{"lists", listCommand},
+		{"sets", setCommand},
+		{"zsets", zsetCommand},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			d := util.NewDiffer(t, srv, rds)
+			defer d.Close()
+			for i := 0; i < 1000; i++ {
+				d.Do(tc.command()...)
+			}
+		})
+	}
+}
+
+func smallInt(n int) string {
+	return fmt.Sprintf("%d", util.RandomSignedInt(int32(n)))
+}
+
+// halves are exactly representable, so the results of float increments are formatted alike
+func half() string {
+	return fmt.Sprintf("%g", float64(util.RandomSignedInt(8))/2)
+}
+
+func value() string {
+	return util.RandPath(
+		func() string { return smallInt(100) },
+		func() string { return util.RandString(0, 8, util.Alpha) },
+	)
+}
+
+func stringCommand() []string {
+	k := func() string { return util.OneOf("s1", "s2", "s3") }
+	return util.RandPath(
+		func() []string { return []string{"SET", k(), value()} },
+		func() []string { return []string{"SET", k(), value(), util.OneOf("NX", "XX")} },
+		func() []string { return []string{"SETNX", k(), value()} },
+		func() []string { return []string{"GETSET", k(), value()} },
+		func() []string { return []string{"GET", k()} },
+		func() []string { return []string{"GETDEL", k()} },
+		func() []string { return []string{"APPEND", k(), value()} },
+		func() []string { return []string{"STRLEN", k()} },
+		func() []string { return []string{"GETRANGE", k(), smallInt(10), smallInt(10)} },
+		func() []string { return []string{"SETRANGE", k(), fmt.Sprintf("%d", rand.Intn(20)), value()} },
+		func() []string { return []string{util.OneOf("INCR", "DECR"), k()} },
+		func() []string { return []string{util.OneOf("INCRBY", "DECRBY"), k(), smallInt(100)} },
+		func() []string { return []string{"INCRBYFLOAT", k(), half()} },
+		func() []string { return []string{"MGET", k(), k()} },
+		func() []string { return []string{"MSET", k(), value(), k(), value()} },
+		func() []string { return []string{util.OneOf("EXISTS", "DEL", "TYPE"), k()} },
+	)
+}
+
+func hashCommand() []string {
+	k := func() string { return util.OneOf("h1", "h2") }
+	f := func() string { return util.OneOf("f1", "f2", "f3", "f4", "f5") }
+	return util.RandPath(
+		func() []string { return []string{"HSET", k(), f(), value()} },
+		func() []string { return []string{"HSET", k(), f(), value(), f(), value()} },
+		func() []string { return []string{"HSETNX", k(), f(), value()} },
+		func() []string { return []string{"HGET", k(), f()} },
+		func() []string { return []string{"HDEL", k(), f(), f()} },
+		func() []string { return []string{util.OneOf("HEXISTS", "HSTRLEN"), k(), f()} },
+		func() []string { return []string{"HINCRBY", k(), f(), smallInt(100)} },
+		func() []string { return []string{"HINCRBYFLOAT", k(), f(), half()} },
+		func() []string { return []string{"HMGET", k(), f(), f(), f()} },
+		func() []string { return []string{util.OneOf("HLEN", "HGETALL", "HKEYS", "HVALS"), k()} },
+		func() []string { return []string{util.OneOf("EXISTS", "DEL", "TYPE"), k()} },
+	)
+}
+
+func listCommand() []string {
+	k := func() string { return util.OneOf("l1", "l2") }
+	e := func() string { return util.OneOf("a", "b", "c", "1", "2") }
+	end := func() string { return util.OneOf("LEFT", "RIGHT") }
+	return util.RandPath(
+		func() []string { return []string{util.OneOf("LPUSH", "RPUSH"), k(), e(), e()} },
+		func() []string { return []string{util.OneOf("LPUSHX", "RPUSHX"), k(), e()} },
+		func() []string { return []string{util.OneOf("LPOP", "RPOP", "LLEN"), k()} },
+		func() []string { return []string{"LRANGE", k(), smallInt(6), smallInt(6)} },
+		func() []string { return []string{"LINDEX", k(), smallInt(6)} },
+		func() []string { return []string{"LSET", k(), smallInt(6), e()} },
+		func() []string { return []string{"LINSERT", k(), util.OneOf("BEFORE", "AFTER"), e(), e()} },
+		func() []string { return []string{"LREM", k(), smallInt(3), e()} },
+		func() []string { return []string{"LTRIM", k(), smallInt(6), smallInt(6)} },
+		func() []string { return []string{"RPOPLPUSH", k(), k()} },
+		func() []string { return []string{"LMOVE", k(), k(), end(), end()} },
+		func() []string { return []string{util.OneOf("EXISTS", "DEL", "TYPE"), k()} },
+	)
+}
+
+func setCommand() []string {
+	k := func() string { return util.OneOf("s1", "s2", "s3") }
+	m := func() string { return util.OneOf("a", "b", "c", "d", "1", "2") }
+	return util.RandPath(
+		func() []string { return []string{"SADD", k(), m(), m()} },
+		func() []string { return []string{"SREM", k(), m(), m()} },
+		func() []string { return []string{util.OneOf("SCARD", "SMEMBERS"), k()} },
+		func() []string { return []string{"SISMEMBER", k(), m()} },
+		func() []string { return []string{"SMISMEMBER", k(), m(), m()} },
+		func() []string { return []string{"SMOVE", k(), k(), m()} },
+		func() []string { return []string{util.OneOf("SDIFF", "SUNION", "SINTER"), k(), k()} },
+		func() []string {
+			return []string{util.OneOf("SDIFFSTORE", "SUNIONSTORE", "SINTERSTORE"), k(), k(), k()}
+		},
+		func() []string { return []string{util.OneOf("EXISTS", "DEL", "TYPE"), k()} },
+	)
+}
+
+func zsetCommand() []string {
+	k := func() string { return util.OneOf("z1", "z2", "z3") }
+	m := func() string { return util.OneOf("a", "b", "c", "d", "e") }
+	score := func() string { return util.OneOf(half(), half(), "-inf", "+inf") }
+	bound := func() string { return util.OneOf(half(), "("+half(), "-inf", "+inf") }
+	lex := func() string { return util.OneOf("-", "+", "[b", "(b", "[d", "(d") }
+	return util.RandPath(
+		func() []string { return []string{"ZADD", k(), score(), m(), score(), m()} },
+		func() []string { return []string{"ZADD", k(), util.OneOf("NX", "XX"), "CH", score(), m()} },
+		func() []string { return []string{"ZADD", k(), "INCR", half(), m()} },
+		func() []string { return []string{"ZINCRBY", k(), half(), m()} },
+		func() []string { return []string{util.OneOf("ZSCORE", "ZRANK", "ZREVRANK"), k(), m()} },
+		func() []string { return []string{"ZCARD", k()} },
+		func() []string { return []string{"ZCOUNT", k(), bound(), bound()} },
+		func() []string { return []string{util.OneOf("ZRANGE", "ZREVRANGE"), k(), smallInt(6), smallInt(6)} },
+		func() []string {
+			return []string{util.OneOf("ZRANGE", "ZREVRANGE"), k(), smallInt(6), smallInt(6), "WITHSCORES"}
+		},
+		func() []string { return []string{"ZRANGEBYSCORE", k(), bound(), bound(), "WITHSCORES"} },
+		func() []string {
+			return []string{"ZRANGEBYSCORE", k(), bound(), bound(), "LIMIT", smallInt(3), smallInt(3)}
+		},
+		func() []string { return []string{"ZREVRANGEBYSCORE", k(), bound(), bound()} },
+		func() []string { return []string{util.OneOf("ZRANGEBYLEX", "ZLEXCOUNT"), k(), lex(), lex()} },
+		func() []string { return []string{"ZREM", k(), m(), m()} },
+		func() []string { return []string{"ZREMRANGEBYRANK", k(), smallInt(6), smallInt(6)} },
+		func() []string { return []string{"ZREMRANGEBYSCORE", k(), bound(), bound()} },
+		func() []string {
+			return []string{util.OneOf("ZPOPMIN", "ZPOPMAX"), k(), fmt.Sprintf("%d", rand.Intn(3))}
+		},
+		func() []string {
+			return []string{util.OneOf("ZUNIONSTORE", "ZINTERSTORE"), k(), "2", k(), k(),
+				"WEIGHTS", half(), half(), "AGGREGATE", util.OneOf("SUM", "MIN", "MAX")}
+		},
+		func() []string { return []string{util.OneOf("EXISTS", "DEL", "TYPE"), k()} },
+	)
+}
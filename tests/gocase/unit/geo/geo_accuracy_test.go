@@ -0,0 +1,378 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package geo
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/apache/incubator-kvrocks/tests/gocase/util"
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	geoLatLimit    = 85.05112878
+	geoEarthRadius = 6372797.560856
+	geoCells       = 1 << 26
+	geoAlphabet    = "0123456789bcdefghjkmnpqrstuvwxyz"
+)
+
+type geoUnit struct {
+	name       string
+	conversion float64
+}
+
+var geoUnits = []geoUnit{{"m", 1}, {"km", 1000}, {"ft", 0.3048}, {"mi", 1609.34}}
+
+func geoInterleave(x, y uint32) uint64 {
+	var bits uint64
+	for i := 0; i < 32; i++ {
+		bits |= uint64(x>>i&1)<<(2*i) | uint64(y>>i&1)<<(2*i+1)
+	}
+	return bits
+}
+
+func geoDeinterleave(bits uint64) (x, y uint32) {
+	for i := 0; i < 32; i++ {
+		x |= uint32(bits>>(2*i)&1) << i
+		y |= uint32(bits>>(2*i+1)&1) << i
+	}
+	return x, y
+}
+
+// geoEncode returns the cell of a point within the given latitude range, with the
+// latitude in the even bits and the longitude in the odd ones.
+func geoEncode(lon, lat, latMin, latMax float64) uint64 {
+	latOffset := (lat - latMin) / (latMax - latMin) * geoCells
+	lonOffset := (lon + 180) / 360 * geoCells
+	return geoInterleave(uint32(latOffset), uint32(lonOffset))
+}
+
+func geoCellRange(i uint32, min, max float64) (float64, float64) {
+	// the conversions keep the additions from being fused, so that
+	// the bounds are rounded the same way as in geohash.cc
+	scale := max - min
+	return min + float64(float64(i)/geoCells*scale), min + float64(float64(i+1)/geoCells*scale)
+}
+
+// geoDecode returns the center of the cell of a score, which is the position
+// GEOPOS replies and searches measure distances from.
+func geoDecode(score uint64) (float64, float64) {
+	ilat, ilon := geoDeinterleave(score)
+	latMin, latMax := geoCellRange(ilat, -geoLatLimit, geoLatLimit)
+	lonMin, lonMax := geoCellRange(ilon, -180, 180)
+	lon := math.Max(math.Min((lonMin+lonMax)/2, 180), -180)
+	lat := math.Max(math.Min((latMin+latMax)/2, geoLatLimit), -geoLatLimit)
+	return lon, lat
+}
+
+// geoHashString re-encodes a position with the standard latitude range. The
+// score only has 52 bits, so the 11th character is always '0'.
+func geoHashString(lon, lat float64) string {
+	bits := geoEncode(lon, lat, -90, 90)
+	var sb strings.Builder
+	for i := 0; i < 10; i++ {
+		sb.WriteByte(geoAlphabet[bits>>(52-(i+1)*5)&0x1f])
+	}
+	sb.WriteByte('0')
+	return sb.String()
+}
+
+// geoRandomEdgePoint returns a point near the latitude limits, the antimeridian
+// or both. The limits themselves are excluded: a longitude of 180 or a latitude
+// of 85.05112878 overflows the 26 bits of a cell, and the cell of -180,-85.05112878
+// is 0, which can't be decoded.
+func geoRandomEdgePoint() (float64, float64) {
+	near := func(limit float64) float64 {
+		d := (1 - rand.Float64()) * []float64{1e-6, 1e-3, 1, 5}[rand.Intn(4)]
+		if util.RandomBool() {
+			return -limit + d
+		}
+		return limit - d
+	}
+	lon, lat := geoRandomPoint()
+	switch rand.Intn(3) {
+	case 0:
+		return lon, near(geoLatLimit)
+	case 1:
+		return near(180), lat
+	default:
+		return near(180), near(geoLatLimit)
+	}
+}
+
+func geoRandomPointNear(lon, lat, spread float64) (float64, float64) {
+	for {
+		plat := lat + (rand.Float64()*2-1)*spread
+		plon := math.Mod(lon+(rand.Float64()*2-1)*spread+540, 360) - 180
+		if plat > -geoLatLimit && plat < geoLatLimit && plon > -180 {
+			return plon, plat
+		}
+	}
+}
+
+type geoMember struct {
+	name     string
+	lon, lat float64
+	score    uint64
+}
+
+func (m geoMember) pos() (float64, float64) {
+	return geoDecode(m.score)
+}
+
+func geoDistances(members []geoMember, lon, lat float64) map[string]float64 {
+	dists := make(map[string]float64, len(members))
+	for _, m := range members {
+		mlon, mlat := m.pos()
+		dists[m.name] = geoDistance(lon, lat, mlon, mlat)
+	}
+	return dists
+}
+
+// geoTolerance covers the rounding of the haversine formula, in meters.
+func geoTolerance(dist float64) float64 {
+	return 1e-6 + 1e-9*dist
+}
+
+// requireGeoRadius checks the members found by a radius search against the
+// distances from the reference, in meters. Members within the tolerance of the
+// circle may be found or not.
+func requireGeoRadius(t *testing.T, dists map[string]float64, lon, lat, radius float64, unit geoUnit, q *redis.GeoRadiusQuery, locs []redis.GeoLocation, byName map[string]geoMember) {
+	order := q.Sort
+	if order == "" && q.Count > 0 {
+		order = "ASC"
+	}
+	if q.Count > 0 {
+		require.LessOrEqual(t, len(locs), q.Count)
+	}
+
+	found := make(map[string]bool, len(locs))
+	for i, loc := range locs {
+		d, ok := dists[loc.Name]
+		require.True(t, ok, loc.Name)
+		require.False(t, found[loc.Name], loc.Name)
+		found[loc.Name] = true
+		require.LessOrEqual(t, d, radius+geoTolerance(radius), loc.Name)
+		if q.WithDist {
+			require.InDelta(t, d/unit.conversion, loc.Dist, geoTolerance(d)/unit.conversion, loc.Name)
+		}
+		if q.WithCoord {
+			lon, lat := byName[loc.Name].pos()
+			require.InDelta(t, lon, loc.Longitude, 1e-9, loc.Name)
+			require.InDelta(t, lat, loc.Latitude, 1e-9, loc.Name)
+		}
+		if i > 0 && order == "ASC" {
+			require.GreaterOrEqual(t, d, dists[locs[i-1].Name]-geoTolerance(d), loc.Name)
+		} else if i > 0 && order == "DESC" {
+			require.LessOrEqual(t, d, dists[locs[i-1].Name]+geoTolerance(d), loc.Name)
+		}
+	}
+
+	// The search boxes are sized for the longitude span at the latitude of the center, which
+	// falls short of the span of the circle away from the equator, so the members close to the
+	// circle may be missed, as for the randomized test of geo_test.go. Near the poles, where the
+	// shortfall is the largest, the members are only required to be found if their longitude is
+	// within 0.9 times the radius from the center, measured along the parallel of the center like
+	// the boxes are.
+	nearPole := math.Abs(lat)+radius/geoEarthRadius*180/math.Pi > 70
+	for name, d := range dists {
+		if found[name] || d > 0.98*radius {
+			continue
+		}
+		if mlon, _ := byName[name].pos(); nearPole && geoDistance(lon, lat, mlon, lat) > 0.9*radius {
+			continue
+		}
+		require.True(t, q.Count > 0 && len(locs) == q.Count, "%s at %v meters isn't found", name, d)
+		last := dists[locs[len(locs)-1].Name]
+		if order == "ASC" {
+			require.GreaterOrEqual(t, d, last-geoTolerance(d), name)
+		} else {
+			require.LessOrEqual(t, d, last+geoTolerance(d), name)
+		}
+	}
+}
+
+func randomGeoQuery() (*redis.GeoRadiusQuery, float64, geoUnit) {
+	unit := geoUnits[rand.Intn(len(geoUnits))]
+	// from 10 meters to 1000 kilometers
+	radius := math.Pow(10, 1+rand.Float64()*5)
+	q := &redis.GeoRadiusQuery{Radius: radius / unit.conversion, Unit: unit.name}
+	q.Sort = []string{"", "ASC", "DESC"}[rand.Intn(3)]
+	if util.RandomInt(3) == 0 {
+		q.Count = 1 + rand.Intn(20)
+	}
+	return q, radius, unit
+}
+
+func TestGeoAccuracy(t *testing.T) {
+	util.SeedRandom(t)
+	srv := util.StartServer(t, map[string]string{})
+	defer srv.Close()
+	ctx := context.Background()
+	rdb := srv.NewClient()
+	defer func() { require.NoError(t, rdb.Close()) }()
+
+	// points are added in clusters, so that searches find some of them
+	var members []geoMember
+	byName := make(map[string]geoMember)
+	for c := 0; c < 20; c++ {
+		lon, lat := geoRandomEdgePoint()
+		if c%3 == 0 {
+			lon, lat = geoRandomPoint()
+		}
+		spread := []float64{1e-3, 0.1, 1, 5}[rand.Intn(4)]
+		var locs []*redis.GeoLocation
+		for i := 0; i < 50; i++ {
+			plon, plat := geoRandomPointNear(lon, lat, spread)
+			m := geoMember{fmt.Sprintf("place:%d", len(members)), plon, plat, geoEncode(plon, plat, -geoLatLimit, geoLatLimit)}
+			members = append(members, m)
+			byName[m.name] = m
+			locs = append(locs, &redis.GeoLocation{Name: m.name, Longitude: plon, Latitude: plat})
+		}
+		require.EqualValues(t, len(locs), rdb.GeoAdd(ctx, "points", locs...).Val())
+	}
+
+	t.Run("GEOADD scores are the cells of the points", func(t *testing.T) {
+		zs := rdb.ZRangeWithScores(ctx, "points", 0, -1).Val()
+		require.Len(t, zs, len(members))
+		for _, z := range zs {
+			m := byName[z.Member.(string)]
+			require.EqualValues(t, m.score, uint64(z.Score), "%s at %v,%v", m.name, m.lon, m.lat)
+		}
+		for _, lat := range []float64{-geoLatLimit - 1e-8, geoLatLimit + 1e-8} {
+			require.ErrorContains(t, rdb.GeoAdd(ctx, "points", &redis.GeoLocation{Name: "x", Longitude: 0, Latitude: lat}).Err(), "invalid")
+		}
+	})
+
+	t.Run("GEOPOS replies the centers of the cells", func(t *testing.T) {
+		names := make([]string, 0, len(members)+1)
+		for _, m := range members {
+			names = append(names, m.name)
+		}
+		positions := rdb.GeoPos(ctx, "points", append(names, "missing")...).Val()
+		require.Len(t, positions, len(members)+1)
+		for i, m := range members {
+			lon, lat := m.pos()
+			require.InDelta(t, lon, positions[i].Longitude, 1e-9, m.name)
+			require.InDelta(t, lat, positions[i].Latitude, 1e-9, m.name)
+			require.InDelta(t, m.lon, positions[i].Longitude, 180.0/geoCells+1e-9, m.name)
+			require.InDelta(t, m.lat, positions[i].Latitude, geoLatLimit/geoCells+1e-9, m.name)
+		}
+		require.Nil(t, positions[len(members)])
+	})
+
+	t.Run("GEOHASH re-encodes the positions with the standard ranges", func(t *testing.T) {
+		names := make([]string, 0, len(members))
+		for _, m := range members {
+			names = append(names, m.name)
+		}
+		hashes := rdb.GeoHash(ctx, "points", names...).Val()
+		require.Len(t, hashes, len(members))
+		for i, m := range members {
+			require.Equal(t, geoHashString(m.pos()), hashes[i], "%s at %v,%v", m.name, m.lon, m.lat)
+		}
+	})
+
+	t.Run("GEODIST is the haversine distance in every unit", func(t *testing.T) {
+		for i := 0; i < 300; i++ {
+			a := rand.Intn(len(members))
+			b := rand.Intn(len(members))
+			if util.RandomBool() {
+				// within the same cluster
+				b = a/50*50 + rand.Intn(50)
+			}
+			unit := geoUnits[rand.Intn(len(geoUnits))]
+			alon, alat := members[a].pos()
+			blon, blat := members[b].pos()
+			d := geoDistance(alon, alat, blon, blat)
+			dist, err := rdb.GeoDist(ctx, "points", members[a].name, members[b].name, unit.name).Result()
+			require.NoError(t, err)
+			require.InDelta(t, d/unit.conversion, dist, geoTolerance(d)/unit.conversion, "%s %s", members[a].name, members[b].name)
+		}
+		require.Equal(t, redis.Nil, rdb.GeoDist(ctx, "points", members[0].name, "missing", "m").Err())
+	})
+
+	t.Run("GEORADIUS and GEORADIUSBYMEMBER find the members within the radius", func(t *testing.T) {
+		for i := 0; i < 300; i++ {
+			q, radius, unit := randomGeoQuery()
+			q.WithCoord = util.RandomBool()
+			q.WithDist = util.RandomBool()
+			m := members[rand.Intn(len(members))]
+			var lon, lat float64
+			var locs []redis.GeoLocation
+			var err error
+			if util.RandomBool() {
+				lon, lat = m.pos()
+				locs, err = rdb.GeoRadiusByMember(ctx, "points", m.name, q).Result()
+			} else {
+				lon, lat = geoRandomPointNear(m.lon, m.lat, 0.1)
+				locs, err = rdb.GeoRadius(ctx, "points", lon, lat, q).Result()
+			}
+			require.NoError(t, err)
+			requireGeoRadius(t, geoDistances(members, lon, lat), lon, lat, radius, unit, q, locs, byName)
+		}
+	})
+
+	t.Run("GEORADIUS STORE and STOREDIST store the members within the radius", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			q, radius, unit := randomGeoQuery()
+			storeDist := util.RandomBool()
+			if storeDist {
+				q.StoreDist = "stored"
+			} else {
+				q.Store = "stored"
+			}
+			// searches are centered on a member, since storing no member at all deletes
+			// the searched key, and the stored key is deleted first, since the members
+			// are added to it
+			lon, lat := members[rand.Intn(len(members))].pos()
+			require.NoError(t, rdb.Del(ctx, "stored").Err())
+			n, err := rdb.GeoRadiusStore(ctx, "points", lon, lat, q).Result()
+			require.NoError(t, err)
+
+			dists := geoDistances(members, lon, lat)
+			zs := rdb.ZRangeWithScores(ctx, "stored", 0, -1).Val()
+			// the reply counts the members found even beyond COUNT
+			require.GreaterOrEqual(t, n, int64(len(zs)))
+			locs := make([]redis.GeoLocation, 0, len(zs))
+			for _, z := range zs {
+				m := byName[z.Member.(string)]
+				if storeDist {
+					require.InDelta(t, dists[m.name]/unit.conversion, z.Score, geoTolerance(dists[m.name])/unit.conversion, m.name)
+				} else {
+					require.EqualValues(t, m.score, uint64(z.Score), m.name)
+				}
+				locs = append(locs, redis.GeoLocation{Name: m.name})
+			}
+			// the stored members are ordered by score, so they are sorted again
+			sort.Slice(locs, func(i, j int) bool {
+				return (dists[locs[i].Name] < dists[locs[j].Name]) != (q.Sort == "DESC")
+			})
+			requireGeoRadius(t, dists, lon, lat, radius, unit, q, locs, byName)
+		}
+	})
+}
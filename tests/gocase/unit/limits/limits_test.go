@@ -22,6 +22,7 @@ package limits
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/apache/incubator-kvrocks/tests/gocase/util"
 	"github.com/stretchr/testify/require"
@@ -57,4 +58,27 @@ func TestNetworkLimits(t *testing.T) {
 
 		require.Fail(t, "maxclients doesn't work refusing connections")
 	})
+
+	t.Run("refused connections don't leak file descriptors", func(t *testing.T) {
+		// the connections of the previous test are closed asynchronously, the baseline is
+		// taken once they're released, the monitor may be running since the server started
+		m := srv.MonitorResources(100 * time.Millisecond)
+		srv.WaitForStableFDs(t, time.Second)
+		m.ResetBaseline(t)
+		for i := 0; i < 5; i++ {
+			var clients []*util.TCPClient
+			for j := 0; j < 50; j++ {
+				c := srv.NewTCPClient()
+				clients = append(clients, c)
+				require.NoError(t, c.WriteArgs("PING"))
+				_, err := c.ReadLine()
+				require.NoError(t, err)
+			}
+			for _, c := range clients {
+				require.NoError(t, c.Close())
+			}
+		}
+		m.RequireNoFDLeak(t, 0)
+		m.RequireRSSBelow(t, 1<<30)
+	})
 }
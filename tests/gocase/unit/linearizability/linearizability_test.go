@@ -0,0 +1,43 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package linearizability
+
+import (
+	"testing"
+
+	"github.com/apache/incubator-kvrocks/tests/gocase/util"
+)
+
+func TestLinearizability(t *testing.T) {
+	util.SeedRandom(t)
+	srv := util.StartServer(t, map[string]string{})
+	defer srv.Close()
+
+	t.Run("Concurrent clients on a single key", func(t *testing.T) {
+		h := util.RegisterWorkload{Keys: []string{"lin-key"}, Clients: 10, Commands: 200}.Run(t, srv)
+		util.RequireLinearizable(t, h.Operations())
+	})
+
+	t.Run("Concurrent clients on a few keys", func(t *testing.T) {
+		keys := []string{"lin-key-1", "lin-key-2", "lin-key-3"}
+		h := util.RegisterWorkload{Keys: keys, Clients: 20, Commands: 200}.Run(t, srv)
+		util.RequireLinearizable(t, h.Operations())
+	})
+}
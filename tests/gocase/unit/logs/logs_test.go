@@ -0,0 +1,74 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package logs
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/apache/incubator-kvrocks/tests/gocase/util"
+	"github.com/stretchr/testify/require"
+)
+
+func containsLog(records []util.LogRecord, pattern string) bool {
+	p := regexp.MustCompile(pattern)
+	for _, record := range records {
+		if p.MatchString(record.Message) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestServerLogs(t *testing.T) {
+	srv := util.StartServer(t, map[string]string{})
+	defer srv.Close()
+
+	ctx := context.Background()
+	rdb := srv.NewClient()
+	defer func() { require.NoError(t, rdb.Close()) }()
+
+	t.Run("Wait for a log of the server", func(t *testing.T) {
+		record := srv.WaitForLog(t, util.LogInfo, "Ready to accept connections", 10*time.Second)
+		require.Equal(t, util.LogInfo, record.Level)
+		require.Equal(t, "server.cc", record.File)
+		require.WithinDuration(t, time.Now(), record.Time, time.Minute)
+	})
+
+	t.Run("Logs since a marker", func(t *testing.T) {
+		marker := srv.LogMarker()
+		require.NoError(t, rdb.ConfigRewrite(ctx).Err())
+		require.Eventually(t, func() bool {
+			return containsLog(srv.LogsSince(marker), "rewrite config, result: OK")
+		}, 10*time.Second, 100*time.Millisecond)
+		require.False(t, containsLog(srv.LogsSince(marker), "Ready to accept connections"))
+	})
+
+	t.Run("Logs are followed across restarts", func(t *testing.T) {
+		marker := srv.LogMarker()
+		srv.Restart()
+		require.Eventually(t, func() bool {
+			return containsLog(srv.LogsSince(marker), "Ready to accept connections")
+		}, 10*time.Second, 100*time.Millisecond)
+		require.True(t, containsLog(srv.LogsSince(0), "rewrite config, result: OK"))
+	})
+}
@@ -51,6 +51,29 @@ func TestMulti(t *testing.T) {
 		require.Equal(t, "[[a b c] PONG]", fmt.Sprintf("%v", v3))
 	})
 
+	t.Run("MULTI / EXEC nested replies", func(t *testing.T) {
+		require.NoError(t, rdb.Del(ctx, "mylist", "mykey").Err())
+		require.NoError(t, rdb.RPush(ctx, "mylist", "a", "b\r\nc").Err())
+
+		c := srv.NewTCPClient()
+		defer func() { require.NoError(t, c.Close()) }()
+		require.NoError(t, c.WriteArgs("MULTI"))
+		c.MustReadReply(t, util.SimpleStringReply("OK"))
+		for _, args := range [][]string{{"LRANGE", "mylist", "0", "-1"}, {"GET", "mykey"}, {"INCR", "mykey"}, {"LPUSH", "mykey", "a"}} {
+			require.NoError(t, c.WriteArgs(args...))
+			c.MustReadReply(t, util.SimpleStringReply("QUEUED"))
+		}
+		require.NoError(t, c.WriteArgs("EXEC"))
+		r, err := c.ReadReply()
+		require.NoError(t, err)
+		require.Len(t, r.Elems, 4)
+		require.Equal(t, util.BulkStringsReply("a", "b\r\nc"), r.Elems[0])
+		require.Equal(t, util.NilBulkStringReply(), r.Elems[1])
+		require.Equal(t, util.IntegerReply(1), r.Elems[2])
+		require.Equal(t, util.ReplyError, r.Elems[3].Type)
+		require.Contains(t, r.Elems[3].Str, "WRONGTYPE")
+	})
+
 	t.Run("DISCARD", func(t *testing.T) {
 		require.NoError(t, rdb.Del(ctx, "mylist").Err())
 		require.NoError(t, rdb.RPush(ctx, "mylist", "a").Err())
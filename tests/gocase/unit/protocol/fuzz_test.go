@@ -0,0 +1,152 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/apache/incubator-kvrocks/tests/gocase/util"
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+// The server may legitimately stay silent, e.g. it waits for the rest of a bulk
+// string or a blocking command, so a request is done once no reply arrives in time.
+const fuzzReplyTimeout = 100 * time.Millisecond
+
+// Commands which would stop the server, change its role or configuration, or
+// switch the connection out of the request/reply protocol are not fuzzed.
+var fuzzUnsafeCommands = [][]byte{
+	[]byte("shutdown"), []byte("debug"), []byte("slaveof"), []byte("config"),
+	[]byte("monitor"), []byte("psync"), []byte("eval"), []byte("script"),
+	[]byte("namespace"), []byte("_fetch"), []byte("_db_name"),
+}
+
+func FuzzInlineRequest(f *testing.F) {
+	srv := util.StartServer(f, map[string]string{})
+	defer srv.Close()
+	rdb := srv.NewClient()
+	defer func() { require.NoError(f, rdb.Close()) }()
+
+	for _, seed := range []string{
+		"",
+		"\r",
+		"ping",
+		"ping x y",
+		"set foo 123",
+		"get foo",
+		"set foo 123\nget foo\r",
+		"*-1\r\nset foo 123\nget foo\r",
+		"\t  \t",
+		"set foo \"bar baz\"",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, line string) {
+		if strings.HasPrefix(line, "*") {
+			t.Skip("multibulk requests are covered by FuzzMultibulkRequest")
+		}
+		checkRequest(t, srv, rdb, []byte(line+"\n"))
+	})
+}
+
+func FuzzMultibulkRequest(f *testing.F) {
+	srv := util.StartServer(f, map[string]string{})
+	defer srv.Close()
+	rdb := srv.NewClient()
+	defer func() { require.NoError(f, rdb.Close()) }()
+
+	blpop := "*3\r\n$5\r\nBLPOP\r\n$6\r\nhandle\r\n$1\r\n0\r\n"
+	for _, seed := range []string{
+		"\r\n*1\r\n$4\r\nPING\r\n",
+		"*20000000\r\n",
+		"*3\r\n$3\r\nSET\r\n$1\r\nx\r\nfoo\r\n",
+		"*3\r\n$3\r\nSET\r\n$1\r\nx\r\n$-10\r\n",
+		"*3\r\n$3\r\nSET\r\n$1\r\nx\r\n$2000000000\r\n",
+		"*3\r\n$3\r\nSET\r\n$1\r\nx\r\n$foo\r\n",
+		"*1\r\nfoo\r\n",
+		"*-1\r\n*3\r\n$3\r\nset\r\n$3\r\nkey\r\n$3\r\nval\r\n",
+		"*-1\r\nset foo 123\nget foo\r\n*3\r\n$3\r\nset\r\n$3\r\nkey\r\n$3\r\nval\r\n",
+		"*3\n$3\r\nset\r\n$3\r\nkey\r\n$3\r\nval\r\n",
+		blpop + blpop,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		checkRequest(t, srv, rdb, data)
+	})
+}
+
+// checkRequest sends the data over a new connection and requires every reply to be
+// well-formed, the connection to be closed right after a protocol error, and the
+// server to be still alive and responsive afterwards.
+func checkRequest(t *testing.T, srv *util.KvrocksServer, rdb *redis.Client, data []byte) {
+	lower := bytes.ToLower(data)
+	for _, cmd := range fuzzUnsafeCommands {
+		if bytes.Contains(lower, cmd) {
+			t.Skipf("the request may contain the unsafe command %q", cmd)
+		}
+	}
+
+	c := srv.NewTCPClient()
+	defer func() { _ = c.Close() }()
+
+	// the server may close the connection before reading all data, e.g. after a protocol error
+	if err := c.Write(string(data)); err == nil {
+		for {
+			require.NoError(t, c.SetReadDeadline(time.Now().Add(fuzzReplyTimeout)))
+			r, err := c.ReadReply()
+			if isTimeout(err) || isClosed(err) {
+				break
+			}
+			require.NoError(t, err, "malformed reply to %q", data)
+			if r.Type == util.ReplyError && strings.HasPrefix(r.Str, "Protocol error") {
+				require.NoError(t, c.SetReadDeadline(time.Now().Add(time.Second)))
+				_, err := c.ReadReply()
+				require.True(t, isClosed(err), "connection is not closed after %q: %v", r.Str, err)
+				break
+			}
+		}
+	}
+
+	require.False(t, srv.Exited(), "server exited after %q", data)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, rdb.Ping(ctx).Err(), "server is unresponsive after %q", data)
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func isClosed(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET)
+}
@@ -117,4 +117,35 @@ func TestProtocolNetwork(t *testing.T) {
 		require.NoError(t, c.Write("*3\n$3\r\nset\r\n$3\r\nkey\r\n$3\r\nval\r\n"))
 		c.MustMatch(t, "invalid multibulk length")
 	})
+
+	t.Run("RESP2 reply types", func(t *testing.T) {
+		c := srv.NewTCPClient()
+		defer func() { require.NoError(t, c.Close()) }()
+		require.NoError(t, c.WriteArgs("SET", "foo", "bar"))
+		c.MustReadReply(t, util.SimpleStringReply("OK"))
+		require.NoError(t, c.WriteArgs("DEL", "foo", "myhash"))
+		c.MustReadReply(t, util.IntegerReply(1))
+		require.NoError(t, c.WriteArgs("GET", "foo"))
+		c.MustReadReply(t, util.NilBulkStringReply())
+		require.NoError(t, c.WriteArgs("SET", "foo", "\x00bar\r\n"))
+		c.MustReadReply(t, util.SimpleStringReply("OK"))
+		require.NoError(t, c.WriteArgs("GET", "foo"))
+		c.MustReadReply(t, util.BulkStringReply("\x00bar\r\n"))
+		require.NoError(t, c.WriteArgs("HSET", "myhash", "f", ""))
+		c.MustReadReply(t, util.IntegerReply(1))
+		// kvrocks replies the empty values of HGETALL as nil bulk strings, unlike Redis
+		require.NoError(t, c.WriteArgs("HGETALL", "myhash"))
+		c.MustReadReply(t, util.ArrayReply(util.BulkStringReply("f"), util.NilBulkStringReply()))
+		require.NoError(t, c.WriteArgs("SET", "empty", ""))
+		c.MustReadReply(t, util.SimpleStringReply("OK"))
+		require.NoError(t, c.WriteArgs("GET", "empty"))
+		c.MustReadReply(t, util.BulkStringReply(""))
+		require.NoError(t, c.WriteArgs("LRANGE", "nolist", "0", "-1"))
+		c.MustReadReply(t, util.ArrayReply())
+		require.NoError(t, c.WriteArgs("INCR", "foo"))
+		r, err := c.ReadReply()
+		require.NoError(t, err)
+		require.Equal(t, util.ReplyError, r.Type)
+		require.Contains(t, r.Str, "ERR")
+	})
 }
@@ -0,0 +1,157 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package resp3
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/incubator-kvrocks/tests/gocase/util"
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+// Kvrocks accepts `HELLO 3` but keeps replying in RESP2, so every reply type below is
+// a RESP2 type. The cases pin down the current behavior of each command family and have
+// to be updated to the RESP3 types (map, set, double, null, push...) once RESP3 is implemented.
+
+func TestRESP3Hello(t *testing.T) {
+	srv := util.StartServer(t, map[string]string{})
+	defer srv.Close()
+
+	c := srv.NewTCPClient()
+	defer func() { require.NoError(t, c.Close()) }()
+
+	t.Run("HELLO 3 replies with proto 2", func(t *testing.T) {
+		require.NoError(t, c.WriteArgs("HELLO", "3"))
+		r, err := c.ReadReply()
+		require.NoError(t, err)
+		require.Equal(t, util.ReplyArray, r.Type)
+		require.GreaterOrEqual(t, len(r.Elems), 6)
+		require.Equal(t, util.BulkStringReply("proto"), r.Elems[2])
+		require.Equal(t, util.IntegerReply(2), r.Elems[3])
+		require.Equal(t, util.BulkStringReply("mode"), r.Elems[4])
+		require.Equal(t, util.BulkStringReply("standalone"), r.Elems[5])
+	})
+}
+
+func TestRESP3ReplyTypes(t *testing.T) {
+	srv := util.StartServer(t, map[string]string{})
+	defer srv.Close()
+
+	ctx := context.Background()
+	rdb := srv.NewClient()
+	defer func() { require.NoError(t, rdb.Close()) }()
+
+	require.NoError(t, rdb.Set(ctx, "string", "1", 0).Err())
+	require.NoError(t, rdb.HSet(ctx, "hash", "f", "v").Err())
+	require.NoError(t, rdb.RPush(ctx, "list", "a").Err())
+	require.NoError(t, rdb.SAdd(ctx, "set", "a").Err())
+	require.NoError(t, rdb.ZAdd(ctx, "zset", redis.Z{Score: 1.5, Member: "a"}).Err())
+	require.NoError(t, rdb.Do(ctx, "SIADD", "sortedint", 1).Err())
+	require.NoError(t, rdb.XAdd(ctx, &redis.XAddArgs{Stream: "stream", ID: "1-1", Values: []string{"f", "v"}}).Err())
+
+	c := srv.NewTCPClient()
+	defer func() { require.NoError(t, c.Close()) }()
+	require.NoError(t, c.WriteArgs("HELLO", "3"))
+	_, err := c.ReadReply()
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		family   string
+		args     []string
+		expected util.Reply
+	}{
+		{"generic", []string{"PING"}, util.SimpleStringReply("PONG")},
+		{"generic", []string{"EXISTS", "string", "nokey"}, util.IntegerReply(1)},
+		{"generic", []string{"TYPE", "hash"}, util.BulkStringReply("hash")},
+		{"generic", []string{"TTL", "string"}, util.IntegerReply(-1)},
+		{"string", []string{"GET", "string"}, util.BulkStringReply("1")},
+		{"string", []string{"GET", "nokey"}, util.NilBulkStringReply()},
+		{"string", []string{"INCRBYFLOAT", "string", "0.5"}, util.BulkStringReply("1.5")},
+		{"string", []string{"MGET", "string", "nokey"}, util.ArrayReply(util.BulkStringReply("1.5"), util.NilBulkStringReply())},
+		{"hash", []string{"HGETALL", "hash"}, util.BulkStringsReply("f", "v")},
+		{"hash", []string{"HGETALL", "nokey"}, util.ArrayReply()},
+		{"hash", []string{"HGET", "hash", "nofield"}, util.NilBulkStringReply()},
+		{"list", []string{"LRANGE", "list", "0", "-1"}, util.BulkStringsReply("a")},
+		{"list", []string{"LPOP", "nokey"}, util.NilBulkStringReply()},
+		{"set", []string{"SMEMBERS", "set"}, util.BulkStringsReply("a")},
+		{"set", []string{"SISMEMBER", "set", "a"}, util.IntegerReply(1)},
+		{"zset", []string{"ZSCORE", "zset", "a"}, util.BulkStringReply("1.5")},
+		{"zset", []string{"ZRANGE", "zset", "0", "-1", "WITHSCORES"}, util.BulkStringsReply("a", "1.5")},
+		{"zset", []string{"ZSCORE", "zset", "nomember"}, util.NilBulkStringReply()},
+		{"sortedint", []string{"SIRANGE", "sortedint", "0", "10"}, util.BulkStringsReply("1")},
+		{"stream", []string{"XRANGE", "stream", "-", "+"}, util.ArrayReply(util.ArrayReply(util.BulkStringReply("1-1"), util.BulkStringsReply("f", "v")))},
+		{"stream", []string{"XREAD", "STREAMS", "stream", "1-1"}, util.NilArrayReply()},
+		{"server", []string{"CONFIG", "GET", "maxclients"}, util.BulkStringsReply("maxclients", "10240")},
+		{"error", []string{"LPUSH", "string", "a"}, util.ErrorReply("WRONGTYPE Operation against a key holding the wrong kind of value")},
+	} {
+		require.NoError(t, c.WriteArgs(tc.args...))
+		r, err := c.ReadReply()
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, r, "%s: %v\nexpected:\n%s\nactual:\n%s", tc.family, tc.args, tc.expected, r)
+	}
+}
+
+func TestRESP3PubSub(t *testing.T) {
+	srv := util.StartServer(t, map[string]string{})
+	defer srv.Close()
+
+	ctx := context.Background()
+	rdb := srv.NewClient()
+	defer func() { require.NoError(t, rdb.Close()) }()
+
+	c := srv.NewTCPClient()
+	defer func() { require.NoError(t, c.Close()) }()
+	require.NoError(t, c.WriteArgs("HELLO", "3"))
+	_, err := c.ReadReply()
+	require.NoError(t, err)
+
+	t.Run("Subscription confirmations are arrays instead of push messages", func(t *testing.T) {
+		require.NoError(t, c.WriteArgs("SUBSCRIBE", "chan"))
+		c.MustReadReply(t, util.ArrayReply(util.BulkStringReply("subscribe"), util.BulkStringReply("chan"), util.IntegerReply(1)))
+		require.NoError(t, c.WriteArgs("PSUBSCRIBE", "ch*"))
+		c.MustReadReply(t, util.ArrayReply(util.BulkStringReply("psubscribe"), util.BulkStringReply("ch*"), util.IntegerReply(2)))
+	})
+
+	t.Run("Published messages are arrays instead of push messages", func(t *testing.T) {
+		require.EqualValues(t, 2, rdb.Publish(ctx, "chan", "hello").Val())
+		for i := 0; i < 2; i++ {
+			r, err := c.ReadReply()
+			require.NoError(t, err)
+			require.Equal(t, util.ReplyArray, r.Type)
+			switch r.Elems[0].Str {
+			case "message":
+				require.Equal(t, util.BulkStringsReply("message", "chan", "hello"), r)
+			case "pmessage":
+				require.Equal(t, util.BulkStringsReply("pmessage", "ch*", "chan", "hello"), r)
+			default:
+				require.Fail(t, "unexpected message", r.String())
+			}
+		}
+	})
+
+	t.Run("Unsubscription confirmations are arrays instead of push messages", func(t *testing.T) {
+		require.NoError(t, c.WriteArgs("UNSUBSCRIBE", "chan"))
+		c.MustReadReply(t, util.ArrayReply(util.BulkStringReply("unsubscribe"), util.BulkStringReply("chan"), util.IntegerReply(1)))
+		require.NoError(t, c.WriteArgs("PUNSUBSCRIBE", "ch*"))
+		c.MustReadReply(t, util.ArrayReply(util.BulkStringReply("punsubscribe"), util.BulkStringReply("ch*"), util.IntegerReply(0)))
+	})
+}
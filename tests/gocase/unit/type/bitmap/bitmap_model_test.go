@@ -0,0 +1,599 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package bitmap
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/apache/incubator-kvrocks/tests/gocase/util"
+	"github.com/stretchr/testify/require"
+)
+
+var bitmapModelKeys = []string{"model-bitmap-1", "model-bitmap-2", "model-bitmap-3"}
+
+const (
+	segmentBytes = 1024
+	segmentBits  = segmentBytes * 8
+	// maxBitmapToString is the default max-bitmap-to-string-mb, GET fails on a larger bitmap.
+	maxBitmapToString = 16 << 20
+	// headBytes covers all offsets which are not near 2^32.
+	headBytes = 4 * segmentBytes
+)
+
+// bitmapValue is either a string or a bitmap, the bytes are kept in the order of GET for both encodings.
+type bitmapValue struct {
+	// native is set for TYPE bitmap, created by SETBIT and BITOP, rather than string.
+	native bool
+	size   int
+	// bytes are the non-zero bytes by index.
+	bytes map[int]byte
+}
+
+func newBitmapValue(native bool) *bitmapValue {
+	return &bitmapValue{native: native, bytes: make(map[int]byte)}
+}
+
+// sparse reports whether the value has offsets near 2^32, it's too large for GET and too slow to scan.
+func (v *bitmapValue) sparse() bool {
+	return v != nil && v.size > maxBitmapToString
+}
+
+func (v *bitmapValue) setByte(i int, b byte) {
+	if b == 0 {
+		delete(v.bytes, i)
+	} else {
+		v.bytes[i] = b
+	}
+}
+
+func (v *bitmapValue) write(offset int, s string) {
+	for i := 0; i < len(s); i++ {
+		v.setByte(offset+i, s[i])
+	}
+	if offset+len(s) > v.size {
+		v.size = offset + len(s)
+	}
+}
+
+func (v *bitmapValue) String() string {
+	b := make([]byte, v.size)
+	for i, x := range v.bytes {
+		b[i] = x
+	}
+	return string(b)
+}
+
+func (v *bitmapValue) bit(offset int64) byte {
+	return v.bytes[int(offset/8)] >> (7 - offset%8) & 1
+}
+
+func (v *bitmapValue) setBit(offset int64, bit byte) byte {
+	old := v.bit(offset)
+	i := int(offset / 8)
+	mask := byte(0x80) >> (offset % 8)
+	v.setByte(i, v.bytes[i]&^mask|mask*bit)
+	if i >= v.size {
+		v.size = i + 1
+	}
+	return old
+}
+
+// byteRange resolves the byte indexes of BITCOUNT and BITPOS, negative ones count from the end.
+func (v *bitmapValue) byteRange(start, stop int64) (int64, int64, bool) {
+	n := int64(v.size)
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop < 0 {
+		stop = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	return start, stop, start <= stop
+}
+
+func (v *bitmapValue) bitCount(start, stop int64) int64 {
+	if start < 0 && stop < 0 && start > stop {
+		return 0
+	}
+	start, stop, ok := v.byteRange(start, stop)
+	if !ok {
+		return 0
+	}
+	n := 0
+	for i, b := range v.bytes {
+		if int64(i) >= start && int64(i) <= stop {
+			n += bits.OnesCount8(b)
+		}
+	}
+	return int64(n)
+}
+
+func (v *bitmapValue) bitPos(bit byte, start, stop int64, stopGiven bool) int64 {
+	start, stop, ok := v.byteRange(start, stop)
+	if !ok {
+		return -1
+	}
+	for offset := start * 8; offset < (stop+1)*8; offset++ {
+		if v.bit(offset) == bit {
+			return offset
+		}
+	}
+	// the bits past the end are clear, unless the range has an explicit end
+	if bit == 1 || stopGiven {
+		return -1
+	}
+	return (stop + 1) * 8
+}
+
+type bitmapModel struct {
+	values map[string]*bitmapValue
+	keys   util.ModelKeyspace
+}
+
+func newBitmapModel() util.Model {
+	m := &bitmapModel{values: make(map[string]*bitmapValue)}
+	m.keys = util.ModelKeyspace{
+		Exists: func(key string) bool { return m.values[key] != nil },
+		Delete: func(key string) { delete(m.values, key) },
+	}
+	return m
+}
+
+func wrongType() util.Reply {
+	return util.ErrorReply("WRONGTYPE Operation against a key holding the wrong kind of value")
+}
+
+func parseOffset(arg string) (int64, bool) {
+	offset, err := strconv.ParseUint(arg, 10, 32)
+	return int64(offset), err == nil
+}
+
+func parseBit(arg string) (byte, bool) {
+	switch arg {
+	case "0":
+		return 0, true
+	case "1":
+		return 1, true
+	}
+	return 0, false
+}
+
+func (m *bitmapModel) bitop(op, dest string, keys []string) util.Reply {
+	op = strings.ToUpper(op)
+	var sources []*bitmapValue
+	size := 0
+	for _, key := range keys {
+		v := m.values[key]
+		if v == nil {
+			continue
+		}
+		if !v.native {
+			return wrongType()
+		}
+		sources = append(sources, v)
+		if v.size > size {
+			size = v.size
+		}
+	}
+	m.keys.Remove(dest)
+	if size == 0 {
+		return util.IntegerReply(0)
+	}
+	result := newBitmapValue(true)
+	result.size = size
+	m.values[dest] = result
+	if op == "NOT" {
+		for i := 0; i < size; i++ {
+			result.setByte(i, ^sources[0].bytes[i])
+		}
+		return util.IntegerReply(int64(size))
+	}
+	// a missing key is all clear, so only the non-zero bytes of the sources may be set
+	indexes := make(map[int]bool)
+	for _, v := range sources {
+		for i := range v.bytes {
+			indexes[i] = true
+		}
+	}
+	for i := range indexes {
+		b := sources[0].bytes[i]
+		for _, v := range sources[1:] {
+			switch op {
+			case "AND":
+				b &= v.bytes[i]
+			case "OR":
+				b |= v.bytes[i]
+			case "XOR":
+				b ^= v.bytes[i]
+			}
+		}
+		if op == "AND" && len(sources) < len(keys) {
+			b = 0
+		}
+		result.setByte(i, b)
+	}
+	return util.IntegerReply(int64(size))
+}
+
+func (m *bitmapModel) Apply(args []string) util.Reply {
+	cmd := strings.ToUpper(args[0])
+	// the type depends on the encoding of the key
+	if cmd == "TYPE" {
+		switch v := m.values[args[1]]; {
+		case v == nil:
+			return util.BulkStringReply("none")
+		case v.native:
+			return util.BulkStringReply("bitmap")
+		default:
+			return util.BulkStringReply("string")
+		}
+	}
+	if r, ok := m.keys.Apply(args); ok {
+		return r
+	}
+
+	key := args[1]
+	v := m.values[key]
+	switch cmd {
+	case "SET":
+		m.keys.Remove(key)
+		v = newBitmapValue(false)
+		v.write(0, args[2])
+		m.values[key] = v
+		return util.SimpleStringReply("OK")
+	case "GET":
+		if v == nil {
+			return util.NilBulkStringReply()
+		}
+		if v.native && v.sparse() {
+			return util.ErrorReply("ERR Operation aborted: The size of the bitmap string exceeds the configuration item max-bitmap-to-string-mb")
+		}
+		return util.BulkStringReply(v.String())
+	case "STRLEN":
+		if v == nil {
+			return util.IntegerReply(0)
+		}
+		if v.native {
+			return wrongType()
+		}
+		return util.IntegerReply(int64(v.size))
+	case "APPEND", "SETRANGE":
+		if v != nil && v.native {
+			return wrongType()
+		}
+		if v == nil {
+			v = newBitmapValue(false)
+			m.values[key] = v
+		}
+		if cmd == "APPEND" {
+			v.write(v.size, args[2])
+		} else {
+			offset, _ := strconv.Atoi(args[2])
+			v.write(offset, args[3])
+		}
+		return util.IntegerReply(int64(v.size))
+	case "SETBIT":
+		offset, ok := parseOffset(args[2])
+		bit, bitOK := parseBit(args[3])
+		if !ok || !bitOK {
+			return util.ErrorReply("ERR bit offset or bit is out of range")
+		}
+		if v == nil {
+			v = newBitmapValue(true)
+			m.values[key] = v
+		}
+		return util.IntegerReply(int64(v.setBit(offset, bit)))
+	case "GETBIT":
+		offset, ok := parseOffset(args[2])
+		if !ok {
+			return util.ErrorReply("ERR bit offset is out of range")
+		}
+		if v == nil {
+			return util.IntegerReply(0)
+		}
+		return util.IntegerReply(int64(v.bit(offset)))
+	case "BITCOUNT":
+		if v == nil {
+			return util.IntegerReply(0)
+		}
+		start, stop := int64(0), int64(-1)
+		if len(args) == 4 {
+			start, _ = strconv.ParseInt(args[2], 10, 64)
+			stop, _ = strconv.ParseInt(args[3], 10, 64)
+		}
+		return util.IntegerReply(v.bitCount(start, stop))
+	case "BITPOS":
+		bit, ok := parseBit(args[2])
+		if !ok {
+			return util.ErrorReply("ERR bit should be 0 or 1")
+		}
+		if v == nil {
+			if bit == 1 {
+				return util.IntegerReply(-1)
+			}
+			return util.IntegerReply(0)
+		}
+		start, stop := int64(0), int64(-1)
+		if len(args) >= 4 {
+			start, _ = strconv.ParseInt(args[3], 10, 64)
+		}
+		if len(args) == 5 {
+			stop, _ = strconv.ParseInt(args[4], 10, 64)
+		}
+		return util.IntegerReply(v.bitPos(bit, start, stop, len(args) == 5))
+	case "BITOP":
+		return m.bitop(args[1], args[2], args[3:])
+	}
+	panic(fmt.Sprintf("unexpected command %q", args))
+}
+
+func (m *bitmapModel) StateQueries() [][]string {
+	var queries [][]string
+	for _, key := range bitmapModelKeys {
+		queries = append(queries, []string{"TYPE", key}, []string{"TTL", key}, []string{"GET", key})
+		v := m.values[key]
+		if !v.sparse() {
+			continue
+		}
+		// GET fails on a sparse bitmap, so the head is counted segment by segment, and the bits
+		// near 2^32 are counted and then checked one by one
+		for i := 0; i < headBytes; i += segmentBytes {
+			queries = append(queries, []string{"BITCOUNT", key, strconv.Itoa(i), strconv.Itoa(i + segmentBytes - 1)})
+		}
+		queries = append(queries, []string{"BITCOUNT", key, strconv.Itoa(v.size - headBytes), "-1"})
+		var tail []int
+		for i := range v.bytes {
+			if i >= headBytes {
+				tail = append(tail, i)
+			}
+		}
+		sort.Ints(tail)
+		for _, i := range tail {
+			for k := 0; k < 8; k++ {
+				if v.bytes[i]>>(7-k)&1 == 1 {
+					queries = append(queries, []string{"GETBIT", key, strconv.Itoa(i*8 + k)})
+				}
+			}
+		}
+	}
+	return queries
+}
+
+// offset picks bit offsets around the first segment boundaries, and near 2^32 if far is set.
+func offset(far bool) string {
+	if far {
+		return strconv.FormatInt(math.MaxUint32-rand.Int63n(2*segmentBits), 10)
+	}
+	return util.RandPath(
+		func() string { return strconv.Itoa(rand.Intn(64)) },
+		func() string { return strconv.Itoa(rand.Intn(3 * segmentBits)) },
+		func() string { return util.OneOf("8191", "8192", "16383", "16384", "16391") },
+	)
+}
+
+// indexes picks n byte indexes of BITCOUNT or BITPOS, they are either at the head or at
+// the tail of a sparse bitmap, since scanning all of it goes through every segment.
+func indexes(v *bitmapValue, n int) []string {
+	size := 0
+	if v != nil {
+		size = v.size
+	}
+	tail := util.RandomBool()
+	var idx []string
+	for i := 0; i < n; i++ {
+		switch {
+		case v.sparse() && tail:
+			idx = append(idx, strconv.Itoa(size-1-rand.Intn(headBytes)))
+		case v.sparse():
+			idx = append(idx, strconv.Itoa(rand.Intn(headBytes)))
+		case rand.Intn(4) == 0:
+			idx = append(idx, util.OneOf("1023", "1024", "-1024", "-1025"))
+		default:
+			idx = append(idx, strconv.FormatInt(util.RandomSignedInt(int32(size+2)), 10))
+		}
+	}
+	return idx
+}
+
+// indexArgs returns the byte indexes of BITCOUNT and BITPOS on a bitmap, strings follow Redis.
+func (m *bitmapModel) indexArgs(args []string) ([]int64, bool) {
+	var from int
+	switch strings.ToUpper(args[0]) {
+	case "BITCOUNT":
+		from = 2
+	case "BITPOS":
+		from = 3
+	default:
+		return nil, false
+	}
+	if v := m.values[args[1]]; v == nil || !v.native {
+		return nil, false
+	}
+	var idx []int64
+	for _, arg := range args[from:] {
+		i, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		idx = append(idx, i)
+	}
+	return idx, true
+}
+
+// setBits sets the bits at the offsets of a bitmap which has none of them set.
+func setBits(t *testing.T, do func(args ...string) util.Reply, key string, offsets ...int) {
+	for _, offset := range offsets {
+		require.Equal(t, util.IntegerReply(0), do("SETBIT", key, strconv.Itoa(offset), "1"))
+	}
+}
+
+var knownBitmapQuirks = []util.Quirk[*bitmapModel]{
+	{
+		// the end of a bitmap is taken as its size rather than its last byte, -1 stays in range
+		Name: "a bitmap resolves negative indexes one byte further",
+		Applies: func(m *bitmapModel, args []string) bool {
+			idx, ok := m.indexArgs(args)
+			return ok && ((len(idx) > 0 && idx[0] < 0) || (len(idx) > 1 && idx[1] < -1))
+		},
+		Check: func(t *testing.T, do func(args ...string) util.Reply) bool {
+			setBits(t, do, "bquirk-negative", 0, 15)
+			if r := do("BITCOUNT", "bquirk-negative", "-2", "-1"); r.Int != 2 {
+				return true
+			}
+			require.Equal(t, util.IntegerReply(1), do("BITCOUNT", "bquirk-negative", "-1", "-1"))
+			return false
+		},
+	},
+	{
+		Name: "BITCOUNT of a bitmap counts nothing in a single byte",
+		Applies: func(m *bitmapModel, args []string) bool {
+			idx, ok := m.indexArgs(args)
+			return ok && strings.ToUpper(args[0]) == "BITCOUNT" && len(idx) == 2 && idx[0] == idx[1]
+		},
+		Check: func(t *testing.T, do func(args ...string) util.Reply) bool {
+			setBits(t, do, "bquirk-single", 0, 15)
+			if r := do("BITCOUNT", "bquirk-single", "0", "0"); r.Int != 1 {
+				return true
+			}
+			require.Equal(t, util.IntegerReply(1), do("BITCOUNT", "bquirk-single", "1", "1"))
+			return false
+		},
+	},
+	{
+		// the bytes a fragment doesn't store are taken as clear regardless of the range
+		Name: "BITPOS 0 of a bitmap finds a clear bit out of the range",
+		Applies: func(m *bitmapModel, args []string) bool {
+			idx, ok := m.indexArgs(args)
+			return ok && strings.ToUpper(args[0]) == "BITPOS" && args[2] == "0" && len(idx) > 0
+		},
+		Check: func(t *testing.T, do func(args ...string) util.Reply) bool {
+			setBits(t, do, "bquirk-bitpos", 0, 1, 2, 3, 4, 5, 6, 7)
+			if r := do("BITPOS", "bquirk-bitpos", "0", "0", "0"); r.Int != -1 {
+				return true
+			}
+			require.Equal(t, util.IntegerReply(8), do("BITPOS", "bquirk-bitpos", "0"))
+			return false
+		},
+	},
+	{
+		Name: "BITOP NOT drops the last segment of a source whose size is a multiple of 1024",
+		Applies: func(m *bitmapModel, args []string) bool {
+			if strings.ToUpper(args[0]) != "BITOP" || strings.ToUpper(args[1]) != "NOT" {
+				return false
+			}
+			v := m.values[args[3]]
+			return v != nil && v.native && v.size%segmentBytes == 0
+		},
+		Check: func(t *testing.T, do func(args ...string) util.Reply) bool {
+			setBits(t, do, "bquirk-not", segmentBits-1)
+			require.Equal(t, util.IntegerReply(segmentBytes), do("BITOP", "NOT", "bquirk-not-dest", "bquirk-not"))
+			if r := do("BITCOUNT", "bquirk-not-dest"); r.Int != segmentBits-1 {
+				return true
+			}
+			require.Equal(t, util.IntegerReply(0), do("GETBIT", "bquirk-not-dest", strconv.Itoa(segmentBits-1)))
+			return false
+		},
+	},
+}
+
+// Command returns a random command which doesn't run into a known quirk.
+func (m *bitmapModel) Command() []string {
+	return util.AvoidQuirks(m, knownBitmapQuirks, m.randomCommand)
+}
+
+func (m *bitmapModel) randomCommand() []string {
+	key := func() string { return bitmapModelKeys[rand.Intn(len(bitmapModelKeys))] }
+	k := key()
+	v := m.values[k]
+	value := func() string { return util.OneOf("a", "foobar", "\xff", "\xff\xff\xf0", "\x00\x01", "\xaa\x55\xaa") }
+	// a string would be allocated up to the offset, so only bitmaps get offsets near 2^32
+	far := (v == nil || v.native) && rand.Intn(8) == 0
+	// a sparse bitmap is a rare source of BITOP, which goes through all of its segments
+	source := func() string {
+		for {
+			if s := key(); !m.values[s].sparse() || rand.Intn(8) == 0 {
+				return s
+			}
+		}
+	}
+	return util.RandPath(
+		func() []string { return []string{"SET", k, value()} },
+		func() []string { return []string{"APPEND", k, value()} },
+		func() []string { return []string{"SETRANGE", k, strconv.Itoa(rand.Intn(40)), value()} },
+		func() []string { return []string{util.OneOf("GET", "STRLEN"), k} },
+		func() []string { return []string{"SETBIT", k, offset(far), util.OneOf("0", "1", "1")} },
+		func() []string { return []string{"GETBIT", k, offset(rand.Intn(4) == 0)} },
+		func() []string {
+			// out of range offsets and bits are rejected
+			return util.RandPath(
+				func() []string { return []string{"SETBIT", k, "4294967296", "1"} },
+				func() []string { return []string{"SETBIT", k, offset(false), "2"} },
+				func() []string { return []string{"BITPOS", k, "2"} },
+			)
+		},
+		func() []string {
+			if v.sparse() {
+				return append([]string{"BITCOUNT", k}, indexes(v, 2)...)
+			}
+			return append([]string{"BITCOUNT", k}, indexes(v, 2*rand.Intn(2))...)
+		},
+		func() []string {
+			args := []string{"BITPOS", k, util.OneOf("0", "1")}
+			if v.sparse() {
+				return append(args, indexes(v, 2)...)
+			}
+			return append(args, indexes(v, rand.Intn(3))...)
+		},
+		func() []string {
+			// NOT writes every byte of its source, so it's only run on a bitmap which isn't sparse
+			if src := key(); !m.values[src].sparse() && rand.Intn(4) == 0 {
+				return []string{"BITOP", "NOT", key(), src}
+			}
+			args := []string{"BITOP", util.OneOf("AND", "OR", "XOR"), key()}
+			for i := rand.Intn(3); i >= 0; i-- {
+				args = append(args, source())
+			}
+			return args
+		},
+		func() []string { return m.keys.Command(k) },
+	)
+}
+func TestBitmapModel(t *testing.T) {
+	util.RunModel(t, newBitmapModel, bitmapModelKeys)
+}
+
+func TestBitmapKnownQuirks(t *testing.T) {
+	util.RunQuirkChecks(t, knownBitmapQuirks)
+}
@@ -0,0 +1,407 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package hash
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/apache/incubator-kvrocks/tests/gocase/util"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slices"
+)
+
+var hashModelKeys = []string{"model-hash-1", "model-hash-2", "model-hash-3"}
+
+type hashModel struct {
+	hashes map[string]map[string]string
+	keys   util.ModelKeyspace
+}
+
+func newHashModel() util.Model {
+	m := &hashModel{hashes: make(map[string]map[string]string)}
+	m.keys = util.ModelKeyspace{
+		Type:   "hash",
+		Exists: func(key string) bool { return len(m.hashes[key]) > 0 },
+		Delete: func(key string) { delete(m.hashes, key) },
+	}
+	return m
+}
+
+func (m *hashModel) sortedFields(key string) []string {
+	fields := make([]string, 0, len(m.hashes[key]))
+	for f := range m.hashes[key] {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// pairs replies the fields and values like HGETALL and HRANGE do.
+func pairs(hash map[string]string, fields []string) util.Reply {
+	ss := make([]string, 0, 2*len(fields))
+	for _, f := range fields {
+		ss = append(ss, f, hash[f])
+	}
+	return util.BulkStringsReply(ss...)
+}
+
+func (m *hashModel) Apply(args []string) util.Reply {
+	if r, ok := m.keys.Apply(args); ok {
+		return r
+	}
+
+	key := args[1]
+	hash := m.hashes[key]
+	if hash == nil {
+		hash = make(map[string]string)
+	}
+	// the key is removed once its last field is deleted
+	defer func() {
+		if len(hash) == 0 {
+			if _, ok := m.hashes[key]; ok {
+				m.keys.Remove(key)
+			}
+		} else {
+			m.hashes[key] = hash
+		}
+	}()
+
+	switch strings.ToUpper(args[0]) {
+	case "HSET":
+		added := 0
+		for i := 2; i+1 < len(args); i += 2 {
+			if _, ok := hash[args[i]]; !ok {
+				added++
+			}
+			hash[args[i]] = args[i+1]
+		}
+		return util.IntegerReply(int64(added))
+	case "HSETNX":
+		if _, ok := hash[args[2]]; ok {
+			return util.IntegerReply(0)
+		}
+		hash[args[2]] = args[3]
+		return util.IntegerReply(1)
+	case "HDEL":
+		deleted := 0
+		for _, f := range args[2:] {
+			if _, ok := hash[f]; ok {
+				deleted++
+				delete(hash, f)
+			}
+		}
+		return util.IntegerReply(int64(deleted))
+	case "HINCRBY":
+		increment, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil {
+			return util.ErrorReply("ERR value is not an integer or out of range")
+		}
+		var old int64
+		if v, ok := hash[args[2]]; ok {
+			if old, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return util.ErrorReply("ERR value is not an integer")
+			}
+		}
+		if (increment < 0 && old < 0 && increment < math.MinInt64-old) ||
+			(increment > 0 && old > 0 && increment > math.MaxInt64-old) {
+			return util.ErrorReply("ERR increment or decrement would overflow")
+		}
+		hash[args[2]] = strconv.FormatInt(old+increment, 10)
+		return util.IntegerReply(old + increment)
+	case "HINCRBYFLOAT":
+		increment, err := strconv.ParseFloat(args[3], 64)
+		if err != nil {
+			return util.ErrorReply("ERR value is not an integer or out of range")
+		}
+		var old float64
+		if v, ok := hash[args[2]]; ok {
+			if old, err = strconv.ParseFloat(v, 64); err != nil {
+				return util.ErrorReply("ERR value is not an float")
+			}
+		}
+		n := old + increment
+		if math.IsInf(n, 0) || math.IsNaN(n) {
+			return util.ErrorReply("ERR increment would produce NaN or Infinity")
+		}
+		hash[args[2]] = fmt.Sprintf("%.17g", n)
+		return util.BulkStringReply(hash[args[2]])
+	case "HMGET":
+		elems := make([]util.Reply, 0, len(args)-2)
+		for _, f := range args[2:] {
+			if v, ok := hash[f]; ok {
+				elems = append(elems, util.BulkStringReply(v))
+			} else {
+				elems = append(elems, util.NilBulkStringReply())
+			}
+		}
+		return util.ArrayReply(elems...)
+	case "HGETALL":
+		return pairs(hash, m.sortedFields(key))
+	case "HSTRLEN":
+		return util.IntegerReply(int64(len(hash[args[2]])))
+	case "HRANGE":
+		limit := int64(math.MaxInt64)
+		if len(args) == 6 {
+			limit, _ = strconv.ParseInt(args[5], 10, 64)
+		}
+		var fields []string
+		if args[2] < args[3] {
+			for _, f := range m.sortedFields(key) {
+				if int64(len(fields)) < limit && f >= args[2] && f < args[3] {
+					fields = append(fields, f)
+				}
+			}
+		}
+		return pairs(hash, fields)
+	case "HSCAN":
+		return m.scan(key, args[2:])
+	}
+	panic(fmt.Sprintf("unexpected command %q", args))
+}
+
+// scan replies like the subkey scanner of kvrocks, which iterates the fields in order from the
+// one after the cursor, and returns the last field as the next cursor if the page is full.
+func (m *hashModel) scan(key string, args []string) util.Reply {
+	cursor, prefix, limit := args[0], "", 20
+	if cursor == "0" {
+		cursor = ""
+	}
+	cursor = strings.TrimPrefix(cursor, "_")
+	for i := 1; i+1 < len(args); i += 2 {
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			prefix = strings.TrimSuffix(args[i+1], "*")
+		case "COUNT":
+			limit, _ = strconv.Atoi(args[i+1])
+		}
+	}
+
+	var fields []string
+	for _, f := range m.sortedFields(key) {
+		if f < cursor || (cursor == "" && f < prefix) || (cursor != "" && f == cursor) {
+			continue
+		}
+		if !strings.HasPrefix(f, prefix) || len(fields) == limit {
+			break
+		}
+		fields = append(fields, f)
+	}
+	next := "0"
+	if len(fields) == limit {
+		next = fields[len(fields)-1]
+	}
+	elems := make([]util.Reply, 0, 2*len(fields))
+	for _, f := range fields {
+		elems = append(elems, util.BulkStringReply(f), util.BulkStringReply(m.hashes[key][f]))
+	}
+	return util.ArrayReply(util.BulkStringReply(next), util.ArrayReply(elems...))
+}
+
+func (m *hashModel) StateQueries() [][]string {
+	var queries [][]string
+	for _, key := range hashModelKeys {
+		queries = append(queries, []string{"HGETALL", key}, []string{"TTL", key})
+	}
+	return queries
+}
+
+// fields returns n fields which often exist in the hash already.
+func (m *hashModel) fields(key string, n int) []string {
+	existing := m.sortedFields(key)
+	var fields []string
+	for len(fields) < n {
+		f := util.RandString(1, 8, util.Alpha)
+		if len(existing) > 0 && util.RandomBool() {
+			f = existing[rand.Intn(len(existing))]
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// hasRepeatedField reports whether a field is repeated in the fields of HSET or HDEL.
+func hasRepeatedField(args []string) bool {
+	var fields []string
+	switch strings.ToUpper(args[0]) {
+	case "HSET":
+		for i := 2; i+1 < len(args); i += 2 {
+			fields = append(fields, args[i])
+		}
+	case "HDEL":
+		fields = args[2:]
+	}
+	for i, f := range fields {
+		if slices.Contains(fields[:i], f) {
+			return true
+		}
+	}
+	return false
+}
+
+var knownHashQuirks = []util.Quirk[*hashModel]{
+	{
+		// the old value is parsed into a float, which is only exact for integers below 2^24
+		Name: "HINCRBYFLOAT reads the old value into a float",
+		Applies: func(m *hashModel, args []string) bool {
+			if strings.ToUpper(args[0]) != "HINCRBYFLOAT" {
+				return false
+			}
+			v, ok := m.hashes[args[1]][args[2]]
+			f, err := strconv.ParseFloat(v, 64)
+			return ok && err == nil && (math.Abs(f) >= 1<<24 || float64(float32(f)) != f)
+		},
+		Check: func(t *testing.T, do func(args ...string) util.Reply) bool {
+			require.Equal(t, util.IntegerReply(1), do("HSET", "hquirk-float", "f", "16777217"))
+			return do("HINCRBYFLOAT", "hquirk-float", "f", "0").Str != "16777217"
+		},
+	},
+	{
+		// the result is stored with std::to_string, so an integer result can't be incremented
+		// by HINCRBY and HSTRLEN counts the decimals
+		Name: "HINCRBYFLOAT stores the result with 6 decimals",
+		Applies: func(m *hashModel, args []string) bool {
+			return strings.ToUpper(args[0]) == "HINCRBYFLOAT"
+		},
+		Check: func(t *testing.T, do func(args ...string) util.Reply) bool {
+			require.Equal(t, util.BulkStringReply("1.5"), do("HINCRBYFLOAT", "hquirk-decimals", "f", "1.5"))
+			r := do("HMGET", "hquirk-decimals", "f")
+			if r.Elems[0].Str != "1.5" {
+				return true
+			}
+			require.Equal(t, util.IntegerReply(3), do("HSTRLEN", "hquirk-decimals", "f"))
+			return false
+		},
+	},
+	{
+		Name: "HGETALL and HRANGE reply empty values as nil",
+		Applies: func(m *hashModel, args []string) bool {
+			switch strings.ToUpper(args[0]) {
+			case "HSET", "HSETNX":
+				for i := 3; i < len(args); i += 2 {
+					if args[i] == "" {
+						return true
+					}
+				}
+			}
+			return false
+		},
+		Check: func(t *testing.T, do func(args ...string) util.Reply) bool {
+			require.Equal(t, util.IntegerReply(1), do("HSET", "hquirk-empty", "f", ""))
+			r := do("HGETALL", "hquirk-empty")
+			if len(r.Elems) == 2 && r.Elems[1].Nil {
+				return true
+			}
+			require.Equal(t, util.BulkStringsReply("f", ""), r)
+			require.Equal(t, util.BulkStringsReply("f", ""), do("HRANGE", "hquirk-empty", "a", "z"))
+			return false
+		},
+	},
+	{
+		// the fields are looked up before any of them is written or deleted, so the size of the
+		// hash is also off
+		Name: "HSET and HDEL count a repeated field more than once",
+		Applies: func(m *hashModel, args []string) bool {
+			return hasRepeatedField(args)
+		},
+		Check: func(t *testing.T, do func(args ...string) util.Reply) bool {
+			if do("HSET", "hquirk-repeated", "a", "1", "a", "2").Int != 1 {
+				return true
+			}
+			if do("HDEL", "hquirk-repeated", "a", "a").Int != 1 {
+				return true
+			}
+			require.Equal(t, util.IntegerReply(0), do("EXISTS", "hquirk-repeated"))
+			return false
+		},
+	},
+}
+
+// Command returns a random command which doesn't run into a known quirk.
+func (m *hashModel) Command() []string {
+	return util.AvoidQuirks(m, knownHashQuirks, m.randomCommand)
+}
+
+func (m *hashModel) randomCommand() []string {
+	key := hashModelKeys[rand.Intn(len(hashModelKeys))]
+	field := func() string { return m.fields(key, 1)[0] }
+	return util.RandPath(
+		func() []string {
+			args := []string{"HSET", key}
+			for _, f := range m.fields(key, 1+rand.Intn(3)) {
+				args = append(args, f, util.RandomValue())
+			}
+			return args
+		},
+		func() []string { return []string{"HSETNX", key, field(), util.RandomValue()} },
+		func() []string { return append([]string{"HDEL", key}, m.fields(key, 1+rand.Intn(3))...) },
+		func() []string {
+			increment := util.RandPath(
+				func() string { return strconv.FormatInt(util.RandomSignedInt(1000), 10) },
+				func() string { return "9223372036854775807" },
+				func() string { return "x" },
+			)
+			return []string{"HINCRBY", key, field(), increment}
+		},
+		func() []string {
+			increment := util.RandPath(
+				func() string { return strconv.FormatInt(util.RandomSignedInt(1000), 10) },
+				func() string { return strconv.FormatFloat(float64(util.RandomSignedInt(100))/4, 'f', -1, 64) },
+				func() string { return "x" },
+			)
+			return []string{"HINCRBYFLOAT", key, field(), increment}
+		},
+		func() []string { return append([]string{"HMGET", key}, m.fields(key, 1+rand.Intn(3))...) },
+		func() []string { return []string{"HGETALL", key} },
+		func() []string { return []string{"HSTRLEN", key, field()} },
+		func() []string {
+			args := []string{"HRANGE", key, field(), field()}
+			if util.RandomBool() {
+				args = append(args, "LIMIT", strconv.FormatInt(util.RandomSignedInt(5), 10))
+			}
+			return args
+		},
+		func() []string {
+			cursor := "0"
+			if util.RandomBool() {
+				cursor = field()
+			}
+			args := []string{"HSCAN", key, cursor}
+			if util.RandomBool() {
+				args = append(args, "MATCH", util.RandString(0, 1, util.Alpha)+"*")
+			}
+			return append(args, "COUNT", strconv.Itoa(1+rand.Intn(5)))
+		},
+		func() []string { return m.keys.Command(key) },
+	)
+}
+
+func TestHashModel(t *testing.T) {
+	util.RunModel(t, newHashModel, hashModelKeys)
+}
+
+func TestHashKnownQuirks(t *testing.T) {
+	util.RunQuirkChecks(t, knownHashQuirks)
+}
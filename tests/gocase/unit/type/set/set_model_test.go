@@ -0,0 +1,427 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package set
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/apache/incubator-kvrocks/tests/gocase/util"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slices"
+)
+
+var setModelKeys = []string{"model-set-1", "model-set-2", "model-set-3"}
+
+// setModelMembers is small so that the sets often overlap.
+var setModelMembers = []string{"a", "b", "c", "d", "e", "1", "2", "3"}
+
+type setModel struct {
+	sets map[string]map[string]bool
+	keys util.ModelKeyspace
+}
+
+func newSetModel() util.Model {
+	m := &setModel{sets: make(map[string]map[string]bool)}
+	m.keys = util.ModelKeyspace{
+		Type:   "set",
+		Exists: func(key string) bool { return len(m.sets[key]) > 0 },
+		Delete: func(key string) { delete(m.sets, key) },
+	}
+	return m
+}
+
+func (m *setModel) sorted(key string) []string {
+	members := make([]string, 0, len(m.sets[key]))
+	for member := range m.sets[key] {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+func (m *setModel) add(key string, members ...string) int {
+	if m.sets[key] == nil {
+		m.sets[key] = make(map[string]bool)
+	}
+	added := 0
+	for _, member := range members {
+		if !m.sets[key][member] {
+			m.sets[key][member] = true
+			added++
+		}
+	}
+	return added
+}
+
+func (m *setModel) remove(key string, members ...string) int {
+	removed := 0
+	for _, member := range members {
+		if m.sets[key][member] {
+			delete(m.sets[key], member)
+			removed++
+		}
+	}
+	if removed > 0 && len(m.sets[key]) == 0 {
+		m.keys.Remove(key)
+	}
+	return removed
+}
+
+// overwrite replaces the destination of a STORE command, which loses its expiration.
+func (m *setModel) overwrite(key string, members []string) util.Reply {
+	m.keys.Remove(key)
+	if len(members) > 0 {
+		m.add(key, members...)
+	}
+	return util.IntegerReply(int64(len(members)))
+}
+
+// algebra computes SDIFF, SUNION or SINTER of the keys, the members are sorted as kvrocks replies them.
+func (m *setModel) algebra(op string, keys []string) []string {
+	counts := make(map[string]int)
+	for _, key := range keys[1:] {
+		for member := range m.sets[key] {
+			counts[member]++
+		}
+	}
+	var members []string
+	switch op {
+	case "SDIFF":
+		for _, member := range m.sorted(keys[0]) {
+			if counts[member] == 0 {
+				members = append(members, member)
+			}
+		}
+	case "SINTER":
+		// a key repeated in the arguments counts once per occurrence
+		for _, member := range m.sorted(keys[0]) {
+			if counts[member] == len(keys)-1 {
+				members = append(members, member)
+			}
+		}
+	case "SUNION":
+		for member := range m.sets[keys[0]] {
+			counts[member]++
+		}
+		for member := range counts {
+			members = append(members, member)
+		}
+		sort.Strings(members)
+	}
+	return members
+}
+
+func (m *setModel) Apply(args []string) util.Reply {
+	if r, ok := m.keys.Apply(args); ok {
+		return r
+	}
+
+	key := args[1]
+	cmd := strings.ToUpper(args[0])
+	switch cmd {
+	case "SADD":
+		return util.IntegerReply(int64(m.add(key, args[2:]...)))
+	case "SREM":
+		return util.IntegerReply(int64(m.remove(key, args[2:]...)))
+	case "SCARD":
+		return util.IntegerReply(int64(len(m.sets[key])))
+	case "SMEMBERS":
+		return util.BulkStringsReply(m.sorted(key)...)
+	case "SISMEMBER":
+		if m.sets[key][args[2]] {
+			return util.IntegerReply(1)
+		}
+		return util.IntegerReply(0)
+	case "SMISMEMBER":
+		var elems []util.Reply
+		for _, member := range args[2:] {
+			if m.sets[key][member] {
+				elems = append(elems, util.IntegerReply(1))
+			} else {
+				elems = append(elems, util.IntegerReply(0))
+			}
+		}
+		return util.ArrayReply(elems...)
+	case "SMOVE":
+		// the member is removed and then added, so a set moving its only member into itself loses its expiration
+		if m.remove(key, args[3]) == 0 {
+			return util.IntegerReply(0)
+		}
+		return util.IntegerReply(int64(m.add(args[2], args[3])))
+	case "SDIFF", "SUNION", "SINTER":
+		return util.BulkStringsReply(m.algebra(cmd, args[1:])...)
+	case "SDIFFSTORE", "SUNIONSTORE", "SINTERSTORE":
+		return m.overwrite(key, m.algebra(strings.TrimSuffix(cmd, "STORE"), args[2:]))
+	}
+	panic(fmt.Sprintf("unexpected command %q", args))
+}
+
+// Observe checks the members replied by SPOP and SRANDMEMBER, which may be any distinct
+// members of the set, or any members for a negative count of SRANDMEMBER. kvrocks replies
+// SRANDMEMBER with an array even without a count.
+func (m *setModel) Observe(args []string, actual util.Reply) (util.Reply, bool) {
+	cmd := strings.ToUpper(args[0])
+	if cmd != "SPOP" && cmd != "SRANDMEMBER" {
+		return util.Reply{}, false
+	}
+	key := args[1]
+	count := 1
+	if len(args) == 3 {
+		count, _ = strconv.Atoi(args[2])
+	}
+	repeats := cmd == "SRANDMEMBER" && count < 0
+	if repeats && len(m.sets[key]) > 0 {
+		count = -count
+	} else if count > len(m.sets[key]) || repeats {
+		count = len(m.sets[key])
+	}
+	expected := fmt.Sprintf("%d distinct members of %q", count, m.sorted(key))
+	if repeats {
+		expected = fmt.Sprintf("%d members of %q", count, m.sorted(key))
+	}
+
+	var members []string
+	if cmd == "SPOP" && len(args) == 2 {
+		if count == 0 {
+			return util.NilBulkStringReply(), true
+		}
+		if actual.Type != util.ReplyBulkString || actual.Nil || !m.sets[key][actual.Str] {
+			return util.SimpleStringReply(fmt.Sprintf("a member of %q", m.sorted(key))), true
+		}
+		members = []string{actual.Str}
+	} else {
+		if actual.Type != util.ReplyArray || actual.Nil || len(actual.Elems) != count {
+			return util.SimpleStringReply(expected), true
+		}
+		seen := make(map[string]bool)
+		for _, e := range actual.Elems {
+			if e.Type != util.ReplyBulkString || e.Nil || !m.sets[key][e.Str] || (seen[e.Str] && !repeats) {
+				return util.SimpleStringReply(expected), true
+			}
+			seen[e.Str] = true
+			members = append(members, e.Str)
+		}
+	}
+	if cmd == "SPOP" {
+		m.remove(key, members...)
+	}
+	return actual, true
+}
+
+func (m *setModel) StateQueries() [][]string {
+	var queries [][]string
+	for _, key := range setModelKeys {
+		queries = append(queries, []string{"SMEMBERS", key}, []string{"TTL", key})
+	}
+	return queries
+}
+
+// distinctMembers returns n distinct members, since SADD and SREM currently count
+// a member repeated in a command more than once.
+func distinctMembers(n int) []string {
+	members := make([]string, 0, n)
+	for _, i := range rand.Perm(len(setModelMembers))[:n] {
+		members = append(members, setModelMembers[i])
+	}
+	return members
+}
+
+var knownSetQuirks = []util.Quirk[*setModel]{
+	{
+		// Set::Take returns no members for a count which isn't positive
+		Name: "SRANDMEMBER with a negative count replies no members",
+		Applies: func(m *setModel, args []string) bool {
+			if strings.ToUpper(args[0]) != "SRANDMEMBER" || len(args) != 3 {
+				return false
+			}
+			count, _ := strconv.Atoi(args[2])
+			return count < 0 && len(m.sets[args[1]]) > 0
+		},
+		Check: func(t *testing.T, do func(args ...string) util.Reply) bool {
+			require.Equal(t, util.IntegerReply(1), do("SADD", "squirk-negative", "a"))
+			r := do("SRANDMEMBER", "squirk-negative", "-2")
+			if len(r.Elems) == 0 {
+				return true
+			}
+			require.Equal(t, util.BulkStringsReply("a", "a"), r)
+			return false
+		},
+	},
+}
+
+// Command returns a random command which doesn't run into a known quirk.
+func (m *setModel) Command() []string {
+	return util.AvoidQuirks(m, knownSetQuirks, m.randomCommand)
+}
+
+func (m *setModel) randomCommand() []string {
+	key := func() string { return setModelKeys[rand.Intn(len(setModelKeys))] }
+	keys := func() []string {
+		keys := []string{key()}
+		for i := rand.Intn(3); i > 0; i-- {
+			keys = append(keys, key())
+		}
+		return keys
+	}
+	member := func() string { return setModelMembers[rand.Intn(len(setModelMembers))] }
+	count := func() string { return strconv.Itoa(rand.Intn(len(setModelMembers) + 2)) }
+	signedCount := func() string { return strconv.Itoa(rand.Intn(2*len(setModelMembers)+3) - len(setModelMembers) - 1) }
+	k := key()
+	return util.RandPath(
+		func() []string { return append([]string{"SADD", k}, distinctMembers(1+rand.Intn(3))...) },
+		func() []string { return append([]string{"SREM", k}, distinctMembers(1+rand.Intn(3))...) },
+		func() []string {
+			return []string{util.RandPath(func() string { return "SCARD" }, func() string { return "SMEMBERS" }), k}
+		},
+		func() []string {
+			// SISMEMBER fails on a missing key in kvrocks, SMISMEMBER covers it
+			if len(m.sets[k]) == 0 {
+				return []string{"SMISMEMBER", k, member()}
+			}
+			return []string{"SISMEMBER", k, member()}
+		},
+		func() []string { return append([]string{"SMISMEMBER", k}, distinctMembers(1+rand.Intn(3))...) },
+		func() []string {
+			// SMOVE replies 0 in kvrocks if the destination has the member already
+			dst, mem := key(), member()
+			if m.sets[dst][mem] {
+				dst = k
+			}
+			return []string{"SMOVE", k, dst, mem}
+		},
+		func() []string {
+			return util.RandPath(
+				func() []string { return []string{"SPOP", k} },
+				func() []string { return []string{"SPOP", k, count()} },
+				func() []string { return []string{"SRANDMEMBER", k} },
+				func() []string { return []string{"SRANDMEMBER", k, signedCount()} },
+			)
+		},
+		func() []string {
+			op := util.RandPath(func() string { return "SDIFF" }, func() string { return "SUNION" }, func() string { return "SINTER" })
+			return append([]string{op}, keys()...)
+		},
+		func() []string {
+			op := util.RandPath(func() string { return "SDIFFSTORE" }, func() string { return "SUNIONSTORE" }, func() string { return "SINTERSTORE" })
+			return append([]string{op, k}, keys()...)
+		},
+		func() []string { return m.keys.Command(k) },
+	)
+}
+
+func TestSetModel(t *testing.T) {
+	util.RunModel(t, newSetModel, setModelKeys)
+}
+
+func TestSetKnownQuirks(t *testing.T) {
+	util.RunQuirkChecks(t, knownSetQuirks)
+}
+
+// requireUniform runs Pearson's chi-squared test on how many times each member was picked,
+// 27.88 is the critical value for 9 degrees of freedom at a significance level of 0.001.
+func requireUniform(t *testing.T, picked map[string]int, members []string) {
+	require.Len(t, members, 10)
+	total := 0
+	for _, n := range picked {
+		total += n
+	}
+	expected := float64(total) / float64(len(members))
+	chiSquared := 0.0
+	for _, member := range members {
+		d := float64(picked[member]) - expected
+		chiSquared += d * d / expected
+	}
+	require.Less(t, chiSquared, 27.88, "members are not picked uniformly: %v", picked)
+}
+
+func TestSetRandomMembers(t *testing.T) {
+	srv := util.StartServer(t, map[string]string{})
+	defer srv.Close()
+	ctx := context.Background()
+	rdb := srv.NewClient()
+	defer func() { require.NoError(t, rdb.Close()) }()
+
+	var members []string
+	for i := 0; i < 10; i++ {
+		members = append(members, fmt.Sprintf("m%d", i))
+	}
+	require.NoError(t, rdb.Del(ctx, "myset").Err())
+	require.NoError(t, rdb.SAdd(ctx, "myset", members).Err())
+
+	// the test is skipped while kvrocks takes the first members in order, and runs once it doesn't
+	inOrder := true
+	for i := 0; i < 20 && inOrder; i++ {
+		r, err := rdb.SRandMemberN(ctx, "myset", 3).Result()
+		require.NoError(t, err)
+		inOrder = slices.Equal(r, members[:3])
+	}
+	if inOrder {
+		t.Skip("known divergence from Redis: SPOP and SRANDMEMBER take the first members in order")
+	}
+
+	t.Run("SRANDMEMBER with a positive count picks distinct members uniformly", func(t *testing.T) {
+		picked := make(map[string]int)
+		for i := 0; i < 2000; i++ {
+			r, err := rdb.SRandMemberN(ctx, "myset", 3).Result()
+			require.NoError(t, err)
+			require.Len(t, r, 3)
+			seen := make(map[string]bool)
+			for _, member := range r {
+				require.Contains(t, members, member)
+				require.False(t, seen[member], "member %s is picked twice", member)
+				seen[member] = true
+				picked[member]++
+			}
+		}
+		requireUniform(t, picked, members)
+	})
+
+	t.Run("SRANDMEMBER with a negative count may pick a member more than once", func(t *testing.T) {
+		picked := make(map[string]int)
+		for i := 0; i < 1000; i++ {
+			r, err := rdb.SRandMemberN(ctx, "myset", -20).Result()
+			require.NoError(t, err)
+			require.Len(t, r, 20)
+			for _, member := range r {
+				require.Contains(t, members, member)
+				picked[member]++
+			}
+		}
+		requireUniform(t, picked, members)
+	})
+
+	t.Run("SPOP picks members uniformly", func(t *testing.T) {
+		picked := make(map[string]int)
+		for i := 0; i < 2000; i++ {
+			member, err := rdb.SPop(ctx, "myset").Result()
+			require.NoError(t, err)
+			require.Contains(t, members, member)
+			picked[member]++
+			require.EqualValues(t, 1, rdb.SAdd(ctx, "myset", member).Val())
+		}
+		requireUniform(t, picked, members)
+	})
+}
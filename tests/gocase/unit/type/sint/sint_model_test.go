@@ -0,0 +1,284 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package sint
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/apache/incubator-kvrocks/tests/gocase/util"
+)
+
+var sintModelKeys = []string{"model-sint-1", "model-sint-2", "model-sint-3"}
+
+// sintModelIDs are few, so that ranges often start or stop at an existing id, and
+// include the boundaries of uint64.
+var sintModelIDs = []uint64{
+	0, 1, 2, 3, 10, 100,
+	math.MaxInt64 - 1, math.MaxInt64, math.MaxInt64 + 1,
+	math.MaxUint64 - 2, math.MaxUint64 - 1, math.MaxUint64,
+}
+
+type sintModel struct {
+	sints map[string]map[uint64]bool
+	keys  util.ModelKeyspace
+}
+
+func newSintModel() util.Model {
+	m := &sintModel{sints: make(map[string]map[uint64]bool)}
+	m.keys = util.ModelKeyspace{
+		Type:   "sortedint",
+		Exists: func(key string) bool { return len(m.sints[key]) > 0 },
+		Delete: func(key string) { delete(m.sints, key) },
+	}
+	return m
+}
+
+func (m *sintModel) sorted(key string, reversed bool) []uint64 {
+	ids := make([]uint64, 0, len(m.sints[key]))
+	for id := range m.sints[key] {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return (ids[i] < ids[j]) != reversed })
+	return ids
+}
+
+func idsReply(ids []uint64) util.Reply {
+	elems := make([]util.Reply, 0, len(ids))
+	for _, id := range ids {
+		elems = append(elems, util.BulkStringReply(strconv.FormatUint(id, 10)))
+	}
+	return util.ArrayReply(elems...)
+}
+
+func parseIDs(args []string) ([]uint64, bool) {
+	ids := make([]uint64, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		ids = append(ids, id)
+	}
+	return ids, true
+}
+
+// valueRange is the range of SIRANGEBYVALUE, which rejects a +inf min and a -inf max.
+type valueRange struct {
+	min, max     uint64
+	minex, maxex bool
+}
+
+func parseValueRange(min, max string) (valueRange, bool) {
+	r := valueRange{min: 0, max: math.MaxUint64}
+	if min == "+inf" || max == "-inf" {
+		return r, false
+	}
+	var err error
+	if min != "-inf" {
+		r.minex = strings.HasPrefix(min, "(")
+		if r.min, err = strconv.ParseUint(strings.TrimPrefix(min, "("), 10, 64); err != nil {
+			return r, false
+		}
+	}
+	if max != "+inf" {
+		r.maxex = strings.HasPrefix(max, "(")
+		if r.max, err = strconv.ParseUint(strings.TrimPrefix(max, "("), 10, 64); err != nil {
+			return r, false
+		}
+	}
+	return r, true
+}
+
+func (r valueRange) contains(id uint64) bool {
+	return (id > r.min || (!r.minex && id == r.min)) && (id < r.max || (!r.maxex && id == r.max))
+}
+
+func (m *sintModel) Apply(args []string) util.Reply {
+	if r, ok := m.keys.Apply(args); ok {
+		return r
+	}
+
+	key := args[1]
+	cmd := strings.ToUpper(args[0])
+	switch cmd {
+	case "SIADD":
+		ids, ok := parseIDs(args[2:])
+		if !ok {
+			return util.ErrorReply("ERR value is not an integer or out of range")
+		}
+		if m.sints[key] == nil {
+			m.sints[key] = make(map[uint64]bool)
+		}
+		added := 0
+		for _, id := range ids {
+			if !m.sints[key][id] {
+				m.sints[key][id] = true
+				added++
+			}
+		}
+		return util.IntegerReply(int64(added))
+	case "SIREM":
+		ids, ok := parseIDs(args[2:])
+		if !ok {
+			return util.ErrorReply("ERR value is not an integer or out of range")
+		}
+		removed := 0
+		for _, id := range ids {
+			if m.sints[key][id] {
+				delete(m.sints[key], id)
+				removed++
+			}
+		}
+		if removed > 0 && len(m.sints[key]) == 0 {
+			m.keys.Remove(key)
+		}
+		return util.IntegerReply(int64(removed))
+	case "SICARD":
+		return util.IntegerReply(int64(len(m.sints[key])))
+	case "SIEXISTS":
+		ids, _ := parseIDs(args[2:])
+		var elems []util.Reply
+		for _, id := range ids {
+			if m.sints[key][id] {
+				elems = append(elems, util.IntegerReply(1))
+			} else {
+				elems = append(elems, util.IntegerReply(0))
+			}
+		}
+		return util.ArrayReply(elems...)
+	case "SIRANGE", "SIREVRANGE":
+		// the range starts from the cursor excluded, and a cursor of 0 stands for the first or
+		// the last id, so the id 0 itself is never replied without another cursor
+		reversed := cmd == "SIREVRANGE"
+		offset, _ := strconv.ParseUint(args[2], 10, 64)
+		limit, _ := strconv.ParseUint(args[3], 10, 64)
+		var cursor uint64
+		if len(args) == 6 {
+			cursor, _ = strconv.ParseUint(args[5], 10, 64)
+		}
+		var ids []uint64
+		var pos uint64
+		for _, id := range m.sorted(key, reversed) {
+			if id == cursor || (!reversed && id < cursor) || (reversed && cursor != 0 && id > cursor) {
+				continue
+			}
+			if pos++; pos <= offset {
+				continue
+			}
+			ids = append(ids, id)
+			if limit > 0 && uint64(len(ids)) == limit {
+				break
+			}
+		}
+		return idsReply(ids)
+	case "SIRANGEBYVALUE", "SIREVRANGEBYVALUE":
+		reversed := cmd == "SIREVRANGEBYVALUE"
+		min, max := args[2], args[3]
+		if reversed {
+			min, max = max, min
+		}
+		r, ok := parseValueRange(min, max)
+		if !ok {
+			return util.ErrorReply("ERR min or max is not an integer")
+		}
+		// a negative offset skips nothing and a count which isn't positive doesn't limit
+		offset, count := 0, 0
+		if len(args) == 7 {
+			offset, _ = strconv.Atoi(args[5])
+			count, _ = strconv.Atoi(args[6])
+		}
+		var ids []uint64
+		pos := 0
+		for _, id := range m.sorted(key, reversed) {
+			if !r.contains(id) {
+				continue
+			}
+			if pos++; pos <= offset {
+				continue
+			}
+			ids = append(ids, id)
+			if count > 0 && len(ids) == count {
+				break
+			}
+		}
+		return idsReply(ids)
+	}
+	panic(fmt.Sprintf("unexpected command %q", args))
+}
+
+func (m *sintModel) StateQueries() [][]string {
+	var queries [][]string
+	for _, key := range sintModelKeys {
+		queries = append(queries, []string{"SIRANGEBYVALUE", key, "-inf", "+inf"}, []string{"TTL", key})
+	}
+	return queries
+}
+
+// distinctIDs returns n distinct ids, since SIADD and SIREM currently count
+// an id repeated in a command more than once.
+func distinctIDs(n int) []string {
+	ids := make([]string, 0, n)
+	for _, i := range rand.Perm(len(sintModelIDs))[:n] {
+		ids = append(ids, strconv.FormatUint(sintModelIDs[i], 10))
+	}
+	return ids
+}
+
+func (m *sintModel) Command() []string {
+	k := sintModelKeys[rand.Intn(len(sintModelKeys))]
+	id := func() string { return distinctIDs(1)[0] }
+	bound := func() string { return util.OneOf(id(), id(), "("+id(), "-inf", "+inf") }
+	small := func() string { return strconv.Itoa(rand.Intn(5)) }
+	return util.RandPath(
+		func() []string { return append([]string{"SIADD", k}, distinctIDs(1+rand.Intn(4))...) },
+		func() []string { return append([]string{"SIREM", k}, distinctIDs(1+rand.Intn(3))...) },
+		func() []string {
+			// out of range ids are rejected
+			return []string{util.OneOf("SIADD", "SIREM"), k, id(), util.OneOf("x", "18446744073709551616")}
+		},
+		func() []string { return []string{"SICARD", k} },
+		func() []string { return append([]string{"SIEXISTS", k}, distinctIDs(1+rand.Intn(3))...) },
+		func() []string {
+			args := []string{util.OneOf("SIRANGE", "SIREVRANGE"), k, small(), small()}
+			if util.RandomBool() {
+				args = append(args, "CURSOR", id())
+			}
+			return args
+		},
+		func() []string {
+			args := []string{util.OneOf("SIRANGEBYVALUE", "SIREVRANGEBYVALUE"), k, bound(), bound()}
+			if util.RandomBool() {
+				args = append(args, "LIMIT", util.OneOf("-1", small()), util.OneOf("-1", small()))
+			}
+			return args
+		},
+		func() []string { return m.keys.Command(k) },
+	)
+}
+
+func TestSintModel(t *testing.T) {
+	util.RunModel(t, newSintModel, sintModelKeys)
+}
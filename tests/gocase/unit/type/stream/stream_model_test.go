@@ -0,0 +1,684 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package stream
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/incubator-kvrocks/tests/gocase/util"
+)
+
+var streamModelKeys = []string{"model-stream-1", "model-stream-2", "model-stream-3"}
+
+type streamID struct {
+	ms, seq uint64
+}
+
+var maxStreamID = streamID{math.MaxUint64, math.MaxUint64}
+
+func (id streamID) less(other streamID) bool {
+	return id.ms < other.ms || (id.ms == other.ms && id.seq < other.seq)
+}
+
+// next returns the smallest ID greater than id, it fails on the last possible ID.
+func (id streamID) next() (streamID, bool) {
+	switch {
+	case id == maxStreamID:
+		return streamID{}, false
+	case id.seq == math.MaxUint64:
+		return streamID{id.ms + 1, 0}, true
+	default:
+		return streamID{id.ms, id.seq + 1}, true
+	}
+}
+
+func (id streamID) String() string {
+	return fmt.Sprintf("%d-%d", id.ms, id.seq)
+}
+
+// parseStreamID parses either ms-seq or ms alone, which stands for ms-seq.
+func parseStreamID(s string, seq uint64) (streamID, bool) {
+	msPart, seqPart, found := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return streamID{}, false
+	}
+	if found {
+		if seq, err = strconv.ParseUint(seqPart, 10, 64); err != nil {
+			return streamID{}, false
+		}
+	}
+	return streamID{ms, seq}, true
+}
+
+type streamEntry struct {
+	id     streamID
+	fields []string
+}
+
+func (e streamEntry) reply() util.Reply {
+	fields := make([]util.Reply, 0, len(e.fields))
+	for _, f := range e.fields {
+		fields = append(fields, util.BulkStringReply(f))
+	}
+	return util.ArrayReply(util.BulkStringReply(e.id.String()), util.ArrayReply(fields...))
+}
+
+func entriesReply(entries []streamEntry) util.Reply {
+	elems := make([]util.Reply, 0, len(entries))
+	for _, e := range entries {
+		elems = append(elems, e.reply())
+	}
+	return util.ArrayReply(elems...)
+}
+
+// stream mirrors the metadata of a stream, which stays after its last entry is removed.
+type stream struct {
+	entries []streamEntry
+	// first and last are the IDs of the first and the last entry recorded in the metadata,
+	// XDEL looks them up in a snapshot taken before any deletion, so they may be entries
+	// deleted by the same command.
+	first, last   streamID
+	lastGenerated streamID
+	maxDeleted    streamID
+	entriesAdded  uint64
+}
+
+func (s *stream) index(id streamID) int {
+	for i, e := range s.entries {
+		if e.id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+type trimOption struct {
+	strategy string
+	maxLen   uint64
+	minID    streamID
+}
+
+// trim removes entries from the head, MINID is compared to the recorded first ID
+// rather than to the entry being removed.
+func (s *stream) trim(t trimOption) int {
+	if len(s.entries) == 0 {
+		return 0
+	}
+	removed := 0
+	var lastDeleted streamID
+	for removed < len(s.entries) {
+		if t.strategy == "MAXLEN" && uint64(len(s.entries)-removed) <= t.maxLen {
+			break
+		}
+		if t.strategy == "MINID" && !s.first.less(t.minID) {
+			break
+		}
+		lastDeleted = s.entries[removed].id
+		removed++
+		s.first = streamID{}
+		if removed < len(s.entries) {
+			s.first = s.entries[removed].id
+		}
+	}
+	s.entries = s.entries[removed:]
+	if len(s.entries) == 0 {
+		s.first, s.last = streamID{}, streamID{}
+	}
+	if removed > 0 {
+		s.maxDeleted = lastDeleted
+	}
+	return removed
+}
+
+func (s *stream) del(ids []streamID) int {
+	snapshot := s.entries
+	deleted := make(map[streamID]bool)
+	for _, id := range ids {
+		i := -1
+		for j, e := range snapshot {
+			if e.id == id {
+				i = j
+			}
+		}
+		if i < 0 {
+			continue
+		}
+		deleted[id] = true
+		if s.maxDeleted.less(id) {
+			s.maxDeleted = id
+		}
+		if len(deleted) == len(snapshot) {
+			s.first, s.last = streamID{}, streamID{}
+			break
+		}
+		if id == s.first {
+			s.first = streamID{}
+			if i+1 < len(snapshot) {
+				s.first = snapshot[i+1].id
+			}
+		}
+		if id == s.last {
+			s.last = streamID{}
+			if i > 0 {
+				s.last = snapshot[i-1].id
+			}
+		}
+	}
+	var kept []streamEntry
+	for _, e := range snapshot {
+		if !deleted[e.id] {
+			kept = append(kept, e)
+		}
+	}
+	s.entries = kept
+	return len(deleted)
+}
+
+// between returns the entries from start to stop in the order of the range, up to count if positive.
+func (s *stream) between(start, stop streamID, exStart, exStop, reverse bool, count int) []streamEntry {
+	if start == stop {
+		if i := s.index(start); i >= 0 && !exStart && !exStop {
+			return s.entries[i : i+1]
+		}
+		return nil
+	}
+	low, high := start, stop
+	if reverse {
+		low, high = stop, start
+	}
+	if high.less(low) {
+		return nil
+	}
+	var entries []streamEntry
+	for i := range s.entries {
+		e := s.entries[i]
+		if reverse {
+			e = s.entries[len(s.entries)-1-i]
+		}
+		if e.id.less(low) || high.less(e.id) || (exStart && e.id == start) {
+			continue
+		}
+		if exStop && e.id == stop {
+			break
+		}
+		entries = append(entries, e)
+		if count > 0 && len(entries) == count {
+			break
+		}
+	}
+	return entries
+}
+
+type xaddArgs struct {
+	nomkstream bool
+	trim       trimOption
+	id         string
+	fields     []string
+}
+
+func parseXAdd(args []string) (xaddArgs, bool) {
+	var x xaddArgs
+	i := 2
+	for ; i < len(args) && x.id == ""; i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NOMKSTREAM":
+			x.nomkstream = true
+		case "MAXLEN", "MINID":
+			x.trim.strategy = strings.ToUpper(args[i])
+			if args[i+1] == "=" {
+				i++
+			}
+			i++
+			var err error
+			var ok bool
+			if x.trim.strategy == "MAXLEN" {
+				x.trim.maxLen, err = strconv.ParseUint(args[i], 10, 64)
+				ok = err == nil
+			} else {
+				x.trim.minID, ok = parseStreamID(args[i], 0)
+			}
+			if !ok {
+				return x, false
+			}
+		default:
+			x.id = args[i]
+		}
+	}
+	x.fields = args[i:]
+	return x, true
+}
+
+type streamModel struct {
+	streams map[string]*stream
+	keys    util.ModelKeyspace
+}
+
+func newStreamModel() util.Model {
+	m := &streamModel{streams: make(map[string]*stream)}
+	m.keys = util.ModelKeyspace{
+		Type:   "stream",
+		Exists: func(key string) bool { return m.streams[key] != nil },
+		Delete: func(key string) { delete(m.streams, key) },
+	}
+	return m
+}
+
+func (m *streamModel) lastGenerated(key string) streamID {
+	if s := m.streams[key]; s != nil {
+		return s.lastGenerated
+	}
+	return streamID{}
+}
+
+// nextID checks an explicit ID of XADD against the last generated one, a sequence
+// number of * is the next one of the same milliseconds.
+func (m *streamModel) nextID(key, arg string) (streamID, error) {
+	msPart, seqPart, _ := strings.Cut(arg, "-")
+	anySeq := seqPart == "*"
+	if anySeq {
+		arg = msPart
+	}
+	id, ok := parseStreamID(arg, 0)
+	if !ok {
+		return id, fmt.Errorf("ERR Invalid stream ID specified as stream command argument")
+	}
+	if id == (streamID{}) && !anySeq {
+		return id, fmt.Errorf("ERR The ID specified in XADD must be greater than 0-0")
+	}
+	last := m.lastGenerated(key)
+	if last == maxStreamID {
+		return id, fmt.Errorf("ERR The stream has exhausted the last possible ID, unable to add more items")
+	}
+	if m.streams[key] == nil {
+		if anySeq && id.ms == 0 {
+			id.seq = 1
+		}
+		return id, nil
+	}
+	if last.ms > id.ms || (last.ms == id.ms && !anySeq && last.seq >= id.seq) {
+		return id, fmt.Errorf("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	}
+	if anySeq && last.ms == id.ms {
+		if last.seq == math.MaxUint64 {
+			return id, fmt.Errorf("ERR Elements are too large to be stored")
+		}
+		id.seq = last.seq + 1
+	}
+	return id, nil
+}
+
+// add trims the stream before adding the entry, which isn't added if it would be trimmed at once,
+// but its ID is generated anyway.
+func (m *streamModel) add(key string, id streamID, x xaddArgs) {
+	s := m.streams[key]
+	if s == nil {
+		s = &stream{}
+		m.streams[key] = s
+	}
+	added := true
+	if x.trim.strategy != "" {
+		t := x.trim
+		if t.strategy == "MAXLEN" && t.maxLen > 0 {
+			t.maxLen--
+		}
+		s.trim(t)
+		if (t.strategy == "MINID" && id.less(t.minID)) || (t.strategy == "MAXLEN" && x.trim.maxLen == 0) {
+			added = false
+		}
+	}
+	s.lastGenerated = id
+	if added {
+		s.entries = append(s.entries, streamEntry{id: id, fields: x.fields})
+		s.last = id
+		if len(s.entries) == 1 {
+			s.first = id
+		}
+	} else {
+		s.maxDeleted = id
+	}
+	s.entriesAdded++
+}
+
+// Observe checks an ID generated by the clock, it's either of the current milliseconds
+// or the next one of the last generated ID if the clock is behind.
+func (m *streamModel) Observe(args []string, actual util.Reply) (util.Reply, bool) {
+	if !strings.EqualFold(args[0], "xadd") {
+		return util.Reply{}, false
+	}
+	key := args[1]
+	x, ok := parseXAdd(args)
+	if !ok || x.id != "*" || (m.streams[key] == nil && x.nomkstream) {
+		return util.Reply{}, false
+	}
+	last := m.lastGenerated(key)
+	next, ok := last.next()
+	if !ok {
+		return util.Reply{}, false
+	}
+	id, ok := parseStreamID(actual.Str, 0)
+	now := uint64(time.Now().UnixMilli())
+	if actual.Type != util.ReplyBulkString || !ok || (id != next && !(last.ms < id.ms && id.seq == 0 && id.ms <= now)) {
+		return util.SimpleStringReply(fmt.Sprintf("generated ID %s doesn't follow %s", actual, last)), true
+	}
+	m.add(key, id, x)
+	return actual, true
+}
+
+func parseBound(arg string, seq uint64) (id streamID, exclusive, ok bool) {
+	switch {
+	case arg == "-":
+		return streamID{}, false, true
+	case arg == "+":
+		return maxStreamID, false, true
+	case strings.HasPrefix(arg, "("):
+		id, ok = parseStreamID(arg[1:], seq)
+		return id, true, ok
+	}
+	id, ok = parseStreamID(arg, seq)
+	return id, false, ok
+}
+
+func (m *streamModel) Apply(args []string) util.Reply {
+	cmd := strings.ToUpper(args[0])
+	// EXPIRE doesn't find an empty stream, which exists for all other commands
+	if s := m.streams[args[1]]; cmd == "EXPIRE" && s != nil && len(s.entries) == 0 {
+		return util.IntegerReply(0)
+	}
+	if r, ok := m.keys.Apply(args); ok {
+		return r
+	}
+
+	key := args[1]
+	s := m.streams[key]
+	switch cmd {
+	case "XADD":
+		x, ok := parseXAdd(args)
+		if !ok {
+			return util.ErrorReply("ERR value is not an integer or out of range")
+		}
+		if s == nil && x.nomkstream {
+			return util.NilBulkStringReply()
+		}
+		if x.id == "*" {
+			// otherwise the ID is generated by the clock, see Observe
+			return util.ErrorReply("ERR last possible entry id reached")
+		}
+		id, err := m.nextID(key, x.id)
+		if err != nil {
+			return util.ErrorReply(err.Error())
+		}
+		m.add(key, id, x)
+		return util.BulkStringReply(id.String())
+	case "XDEL":
+		if s == nil {
+			return util.IntegerReply(0)
+		}
+		var ids []streamID
+		for _, arg := range args[2:] {
+			id, _ := parseStreamID(arg, 0)
+			ids = append(ids, id)
+		}
+		return util.IntegerReply(int64(s.del(ids)))
+	case "XTRIM":
+		t := trimOption{strategy: strings.ToUpper(args[2])}
+		arg := args[3]
+		if arg == "=" {
+			arg = args[4]
+		}
+		if t.strategy == "MAXLEN" {
+			t.maxLen, _ = strconv.ParseUint(arg, 10, 64)
+		} else {
+			t.minID, _ = parseStreamID(arg, 0)
+		}
+		if s == nil {
+			return util.IntegerReply(0)
+		}
+		return util.IntegerReply(int64(s.trim(t)))
+	case "XLEN":
+		if s == nil {
+			return util.IntegerReply(0)
+		}
+		return util.IntegerReply(int64(len(s.entries)))
+	case "XRANGE", "XREVRANGE":
+		// an ID without sequence number covers all of its milliseconds
+		reverse := cmd == "XREVRANGE"
+		startSeq, stopSeq := uint64(0), uint64(math.MaxUint64)
+		if reverse {
+			startSeq, stopSeq = stopSeq, startSeq
+		}
+		start, exStart, _ := parseBound(args[2], startSeq)
+		stop, exStop, _ := parseBound(args[3], stopSeq)
+		count := 0
+		if len(args) == 6 {
+			count, _ = strconv.Atoi(args[5])
+			if count == 0 {
+				return util.NilBulkStringReply()
+			}
+		}
+		if (exStart && start == maxStreamID) || (exStop && stop == streamID{}) {
+			return util.ErrorReply("ERR invalid interval")
+		}
+		if s == nil {
+			return util.ArrayReply()
+		}
+		return entriesReply(s.between(start, stop, exStart, exStop, reverse, count))
+	case "XREAD":
+		count, withCount := 0, false
+		i := 1
+		for ; !strings.EqualFold(args[i], "streams"); i++ {
+			if strings.EqualFold(args[i], "count") {
+				count, _ = strconv.Atoi(args[i+1])
+				withCount = true
+				i++
+			}
+		}
+		n := (len(args) - i - 1) / 2
+		var results []util.Reply
+		for j := 0; j < n; j++ {
+			key, arg := args[i+1+j], args[i+1+n+j]
+			if arg == "$" || (withCount && count == 0) {
+				continue
+			}
+			start, _ := parseStreamID(arg, 0)
+			if start == maxStreamID {
+				return util.ErrorReply("ERR invalid start ID for the interval")
+			}
+			s := m.streams[key]
+			if s == nil {
+				continue
+			}
+			if entries := s.between(start, maxStreamID, true, false, false, count); len(entries) > 0 {
+				results = append(results, util.ArrayReply(util.BulkStringReply(key), entriesReply(entries)))
+			}
+		}
+		if len(results) == 0 {
+			return util.NilArrayReply()
+		}
+		return util.ArrayReply(results...)
+	case "XINFO":
+		return m.info(args)
+	}
+	panic(fmt.Sprintf("unexpected command %q", args))
+}
+
+// info replies XINFO STREAM, the first and the last entries are found by the IDs in the metadata.
+func (m *streamModel) info(args []string) util.Reply {
+	s := m.streams[args[2]]
+	if s == nil {
+		return util.ErrorReply("ERR no such key")
+	}
+	reply := []util.Reply{
+		util.BulkStringReply("length"), util.IntegerReply(int64(len(s.entries))),
+		util.BulkStringReply("last-generated-id"), util.BulkStringReply(s.lastGenerated.String()),
+		util.BulkStringReply("max-deleted-entry-id"), util.BulkStringReply(s.maxDeleted.String()),
+		util.BulkStringReply("entries-added"), util.IntegerReply(int64(s.entriesAdded)),
+		util.BulkStringReply("recorded-first-entry-id"), util.BulkStringReply(s.first.String()),
+	}
+	if len(args) > 3 && strings.EqualFold(args[3], "full") {
+		count := 10
+		if len(args) > 5 {
+			count, _ = strconv.Atoi(args[5])
+		}
+		var entries []streamEntry
+		if len(s.entries) > 0 {
+			entries = s.between(s.first, s.last, false, false, false, count)
+		}
+		return util.ArrayReply(append(reply, util.BulkStringReply("entries"), entriesReply(entries))...)
+	}
+	first, last := util.NilBulkStringReply(), util.NilBulkStringReply()
+	if len(s.entries) > 0 {
+		i, j := s.index(s.first), s.index(s.last)
+		if i < 0 || j < 0 {
+			return util.ErrorReply("ERR no such key")
+		}
+		first, last = s.entries[i].reply(), s.entries[j].reply()
+	}
+	return util.ArrayReply(append(reply, util.BulkStringReply("first-entry"), first, util.BulkStringReply("last-entry"), last)...)
+}
+
+func (m *streamModel) StateQueries() [][]string {
+	var queries [][]string
+	for _, key := range streamModelKeys {
+		queries = append(queries,
+			[]string{"XRANGE", key, "-", "+"},
+			// the last generated ID and the counters of added and deleted entries
+			[]string{"XINFO", "STREAM", key},
+			[]string{"TTL", key},
+		)
+	}
+	return queries
+}
+
+func (m *streamModel) Command() []string {
+	key := func() string { return streamModelKeys[rand.Intn(len(streamModelKeys))] }
+	k := key()
+	s := m.streams[k]
+	if s == nil {
+		s = &stream{}
+	}
+	last := s.lastGenerated
+	// ids are mostly the ones of entries, or next to them
+	id := func() string {
+		if len(s.entries) == 0 || rand.Intn(4) == 0 {
+			return util.OneOf("0", "0-1", "1", last.String(), strconv.FormatUint(last.ms, 10))
+		}
+		e := s.entries[rand.Intn(len(s.entries))].id
+		next, _ := e.next()
+		return util.OneOf(e.String(), e.String(), next.String(), strconv.FormatUint(e.ms, 10))
+	}
+	eq := func() []string {
+		if util.RandomBool() {
+			return []string{"="}
+		}
+		return nil
+	}
+	return util.RandPath(
+		func() []string {
+			args := []string{"XADD", k}
+			if rand.Intn(8) == 0 {
+				args = append(args, "NOMKSTREAM")
+			}
+			switch rand.Intn(6) {
+			case 0:
+				args = append(append(append(args, "MAXLEN"), eq()...), strconv.Itoa(rand.Intn(4)))
+			case 1:
+				args = append(append(append(args, "MINID"), eq()...), id())
+			}
+			// IDs from the clock, next to the last generated one, far in the future and the largest ones
+			args = append(args, util.RandPath(
+				func() string { return "*" },
+				func() string { return "*" },
+				func() string {
+					return util.OneOf(fmt.Sprintf("%d-*", last.ms), fmt.Sprintf("%d-*", last.ms+1), fmt.Sprintf("%d-%d", last.ms, last.seq+1),
+						fmt.Sprintf("%d", last.ms+1), last.String(), "0-*", "0-0", "1-1")
+				},
+				func() string {
+					return util.OneOf("99999999999999-*", "18446744073709551615-18446744073709551614", "18446744073709551615-*")
+				},
+			))
+			for i := rand.Intn(2); i >= 0; i-- {
+				args = append(args, util.OneOf("a", "b", "c"), util.OneOf("1", "2", "x"))
+			}
+			return args
+		},
+		func() []string {
+			// an ID repeated in XDEL is counted more than once, so they are distinct
+			args := []string{"XDEL", k}
+			seen := make(map[string]bool)
+			for i := rand.Intn(3); i >= 0; i-- {
+				if e := id(); !seen[e] {
+					seen[e] = true
+					args = append(args, e)
+				}
+			}
+			return args
+		},
+		func() []string {
+			if util.RandomBool() {
+				return append(append([]string{"XTRIM", k, "MAXLEN"}, eq()...), strconv.Itoa(rand.Intn(4)))
+			}
+			return append(append([]string{"XTRIM", k, "MINID"}, eq()...), id())
+		},
+		func() []string { return []string{"XLEN", k} },
+		func() []string {
+			bound := func() string { return util.OneOf("-", "+", id(), id(), "("+id()) }
+			args := []string{util.OneOf("XRANGE", "XREVRANGE"), k, bound(), bound()}
+			if util.RandomBool() {
+				args = append(args, "COUNT", strconv.Itoa(rand.Intn(4)))
+			}
+			return args
+		},
+		func() []string {
+			args := []string{"XREAD"}
+			if util.RandomBool() {
+				args = append(args, "COUNT", strconv.Itoa(rand.Intn(4)))
+			}
+			args = append(args, "STREAMS", k)
+			ids := []string{util.OneOf("0", "$", id(), id())}
+			if util.RandomBool() {
+				args = append(args, key())
+				ids = append(ids, util.OneOf("0", "$"))
+			}
+			return append(args, ids...)
+		},
+		func() []string {
+			args := []string{"XINFO", "STREAM", k}
+			if util.RandomBool() {
+				args = append(args, "FULL")
+				if util.RandomBool() {
+					args = append(args, "COUNT", strconv.Itoa(rand.Intn(4)))
+				}
+			}
+			return args
+		},
+		func() []string { return m.keys.Command(k) },
+	)
+}
+
+func TestStreamModel(t *testing.T) {
+	util.RunModel(t, newStreamModel, streamModelKeys)
+}
@@ -0,0 +1,816 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package zset
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/apache/incubator-kvrocks/tests/gocase/util"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+var zsetModelKeys = []string{"model-zset-1", "model-zset-2", "model-zset-3"}
+
+// zsetModelMembers is small so that members often share scores and show up in several keys.
+var zsetModelMembers = []string{"a", "b", "c", "d", "e", "f"}
+
+type memberScore struct {
+	member string
+	score  float64
+}
+
+type zsetModel struct {
+	zsets map[string]map[string]float64
+	keys  util.ModelKeyspace
+}
+
+func newZSetModel() util.Model {
+	m := &zsetModel{zsets: make(map[string]map[string]float64)}
+	m.keys = util.ModelKeyspace{
+		Type:   "zset",
+		Exists: func(key string) bool { return len(m.zsets[key]) > 0 },
+		Delete: func(key string) { delete(m.zsets, key) },
+	}
+	return m
+}
+
+// sorted returns the members ordered by score, and by member for equal scores.
+func (m *zsetModel) sorted(key string) []memberScore {
+	mss := make([]memberScore, 0, len(m.zsets[key]))
+	for member, score := range m.zsets[key] {
+		mss = append(mss, memberScore{member, score})
+	}
+	sort.Slice(mss, func(i, j int) bool {
+		if mss[i].score != mss[j].score {
+			return mss[i].score < mss[j].score
+		}
+		return mss[i].member < mss[j].member
+	})
+	return mss
+}
+
+func reversed(mss []memberScore) []memberScore {
+	r := make([]memberScore, 0, len(mss))
+	for i := len(mss) - 1; i >= 0; i-- {
+		r = append(r, mss[i])
+	}
+	return r
+}
+
+func formatScore(score float64) string {
+	if math.IsInf(score, 0) {
+		if score > 0 {
+			return "inf"
+		}
+		return "-inf"
+	}
+	return fmt.Sprintf("%.17g", score)
+}
+
+func membersReply(mss []memberScore, withScores bool) util.Reply {
+	var elems []util.Reply
+	for _, ms := range mss {
+		elems = append(elems, util.BulkStringReply(ms.member))
+		if withScores {
+			elems = append(elems, util.BulkStringReply(formatScore(ms.score)))
+		}
+	}
+	return util.ArrayReply(elems...)
+}
+
+type scoreRange struct {
+	min, max     float64
+	minex, maxex bool
+}
+
+func (r scoreRange) contains(score float64) bool {
+	return (score > r.min || (!r.minex && score == r.min)) && (score < r.max || (!r.maxex && score == r.max))
+}
+
+// parseScoreRange parses the bounds like kvrocks, which rejects a +inf min and a -inf max
+// instead of returning an empty range.
+func parseScoreRange(min, max string) (scoreRange, bool) {
+	var r scoreRange
+	if min == "+inf" || max == "-inf" {
+		return r, false
+	}
+	parse := func(s string) (float64, bool, bool) {
+		ex := strings.HasPrefix(s, "(")
+		f, err := strconv.ParseFloat(strings.TrimPrefix(s, "("), 64)
+		return f, ex, err == nil && !math.IsNaN(f)
+	}
+	var ok bool
+	if r.min, r.minex, ok = parse(min); !ok {
+		return r, false
+	}
+	if r.max, r.maxex, ok = parse(max); !ok {
+		return r, false
+	}
+	return r, true
+}
+
+type lexRange struct {
+	min, max     string
+	minex, maxex bool
+	maxInfinite  bool
+}
+
+func (r lexRange) contains(member string) bool {
+	if member < r.min || (r.minex && member == r.min) {
+		return false
+	}
+	return r.maxInfinite || member < r.max || (!r.maxex && member == r.max)
+}
+
+func parseLexRange(min, max string) (lexRange, bool) {
+	var r lexRange
+	if min == "+" || max == "-" {
+		return r, false
+	}
+	if min != "-" {
+		if min[0] != '(' && min[0] != '[' {
+			return r, false
+		}
+		r.min, r.minex = min[1:], min[0] == '('
+	}
+	if max == "+" {
+		r.maxInfinite = true
+	} else {
+		if max[0] != '(' && max[0] != '[' {
+			return r, false
+		}
+		r.max, r.maxex = max[1:], max[0] == '('
+	}
+	return r, true
+}
+
+// rankRange resolves negative ranks and clamps them like ZRANGE does.
+func rankRange(n, start, stop int) (int, int, bool) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	return start, stop, start <= stop
+}
+
+// limit skips offset members and keeps at most count of them, a negative count keeps all and
+// a negative offset keeps none.
+func limit(mss []memberScore, offset, count int) []memberScore {
+	if offset < 0 || offset >= len(mss) {
+		return nil
+	}
+	mss = mss[offset:]
+	if count >= 0 && count < len(mss) {
+		mss = mss[:count]
+	}
+	return mss
+}
+
+// setScore sets the score of the member unless it's equal to the current one, so that a score
+// of -0 is kept when 0 is added or incremented by, as Redis does.
+func setScore(zset map[string]float64, member string, score float64) {
+	if old, ok := zset[member]; !ok || old != score {
+		zset[member] = score
+	}
+}
+
+func (m *zsetModel) remove(key string, mss []memberScore) {
+	for _, ms := range mss {
+		delete(m.zsets[key], ms.member)
+	}
+	if len(mss) > 0 && len(m.zsets[key]) == 0 {
+		m.keys.Remove(key)
+	}
+}
+
+func (m *zsetModel) Apply(args []string) util.Reply {
+	if r, ok := m.keys.Apply(args); ok {
+		return r
+	}
+
+	key := args[1]
+	zset := m.zsets[key]
+	cmd := strings.ToUpper(args[0])
+	switch cmd {
+	case "ZADD":
+		var mss []memberScore
+		for i := 2; i+1 < len(args); i += 2 {
+			score, err := strconv.ParseFloat(args[i], 64)
+			if err != nil || math.IsNaN(score) {
+				return util.ErrorReply("ERR score is not a valid float")
+			}
+			mss = append(mss, memberScore{args[i+1], score})
+		}
+		if zset == nil {
+			zset = make(map[string]float64)
+			m.zsets[key] = zset
+		}
+		added := 0
+		for _, ms := range mss {
+			if _, ok := zset[ms.member]; !ok {
+				added++
+			}
+			setScore(zset, ms.member, ms.score)
+		}
+		return util.IntegerReply(int64(added))
+	case "ZINCRBY":
+		increment, err := strconv.ParseFloat(args[2], 64)
+		if err != nil {
+			return util.ErrorReply("ERR value is not an double or out of range")
+		}
+		score := zset[args[3]] + increment
+		if math.IsNaN(score) {
+			return util.ErrorReply("ERR resulting score is not a number (NaN)")
+		}
+		if zset == nil {
+			zset = make(map[string]float64)
+			m.zsets[key] = zset
+		}
+		setScore(zset, args[3], score)
+		return util.BulkStringReply(formatScore(score))
+	case "ZSCORE":
+		if score, ok := zset[args[2]]; ok {
+			return util.BulkStringReply(formatScore(score))
+		}
+		return util.NilBulkStringReply()
+	case "ZMSCORE":
+		var elems []util.Reply
+		for _, member := range args[2:] {
+			if score, ok := zset[member]; ok {
+				elems = append(elems, util.BulkStringReply(formatScore(score)))
+			} else {
+				elems = append(elems, util.NilBulkStringReply())
+			}
+		}
+		return util.ArrayReply(elems...)
+	case "ZCARD":
+		return util.IntegerReply(int64(len(zset)))
+	case "ZRANK", "ZREVRANK":
+		mss := m.sorted(key)
+		if cmd == "ZREVRANK" {
+			mss = reversed(mss)
+		}
+		for i, ms := range mss {
+			if ms.member == args[2] {
+				return util.IntegerReply(int64(i))
+			}
+		}
+		return util.NilBulkStringReply()
+	case "ZRANGE", "ZREVRANGE", "ZREMRANGEBYRANK":
+		mss := m.sorted(key)
+		if cmd == "ZREVRANGE" {
+			mss = reversed(mss)
+		}
+		start, _ := strconv.Atoi(args[2])
+		stop, _ := strconv.Atoi(args[3])
+		if start, stop, ok := rankRange(len(mss), start, stop); ok {
+			mss = mss[start : stop+1]
+		} else {
+			mss = nil
+		}
+		if cmd == "ZREMRANGEBYRANK" {
+			m.remove(key, mss)
+			return util.IntegerReply(int64(len(mss)))
+		}
+		return membersReply(mss, len(args) > 4 && strings.EqualFold(args[4], "withscores"))
+	case "ZCOUNT", "ZRANGEBYSCORE", "ZREVRANGEBYSCORE", "ZREMRANGEBYSCORE":
+		min, max := args[2], args[3]
+		if cmd == "ZREVRANGEBYSCORE" {
+			min, max = max, min
+		}
+		r, ok := parseScoreRange(min, max)
+		if !ok {
+			return util.ErrorReply("ERR min or max is not a float")
+		}
+		var mss []memberScore
+		for _, ms := range m.sorted(key) {
+			if r.contains(ms.score) {
+				mss = append(mss, ms)
+			}
+		}
+		if cmd == "ZREVRANGEBYSCORE" {
+			mss = reversed(mss)
+		}
+		withScores := false
+		for i := 4; i < len(args); i++ {
+			if strings.EqualFold(args[i], "withscores") {
+				withScores = true
+			} else if strings.EqualFold(args[i], "limit") {
+				offset, _ := strconv.Atoi(args[i+1])
+				count, _ := strconv.Atoi(args[i+2])
+				mss = limit(mss, offset, count)
+				i += 2
+			}
+		}
+		switch cmd {
+		case "ZCOUNT":
+			return util.IntegerReply(int64(len(mss)))
+		case "ZREMRANGEBYSCORE":
+			m.remove(key, mss)
+			return util.IntegerReply(int64(len(mss)))
+		}
+		return membersReply(mss, withScores)
+	case "ZRANGEBYLEX", "ZREVRANGEBYLEX", "ZLEXCOUNT", "ZREMRANGEBYLEX":
+		min, max := args[2], args[3]
+		if cmd == "ZREVRANGEBYLEX" {
+			min, max = max, min
+		}
+		r, ok := parseLexRange(min, max)
+		if !ok {
+			return util.ErrorReply("ERR min or max not valid string range item")
+		}
+		// lex ranges are ordered by member only, whatever the scores are
+		var mss []memberScore
+		for _, ms := range m.sorted(key) {
+			if r.contains(ms.member) {
+				mss = append(mss, ms)
+			}
+		}
+		sort.Slice(mss, func(i, j int) bool { return mss[i].member < mss[j].member })
+		if cmd == "ZREVRANGEBYLEX" {
+			mss = reversed(mss)
+		}
+		if len(args) == 7 {
+			offset, _ := strconv.Atoi(args[5])
+			count, _ := strconv.Atoi(args[6])
+			mss = limit(mss, offset, count)
+		}
+		switch cmd {
+		case "ZLEXCOUNT":
+			return util.IntegerReply(int64(len(mss)))
+		case "ZREMRANGEBYLEX":
+			m.remove(key, mss)
+			return util.IntegerReply(int64(len(mss)))
+		}
+		return membersReply(mss, false)
+	case "ZREM":
+		var mss []memberScore
+		for _, member := range args[2:] {
+			if score, ok := zset[member]; ok {
+				mss = append(mss, memberScore{member, score})
+				delete(zset, member)
+			}
+		}
+		m.remove(key, mss)
+		return util.IntegerReply(int64(len(mss)))
+	case "ZPOPMIN", "ZPOPMAX":
+		count := 1
+		if len(args) > 2 {
+			count, _ = strconv.Atoi(args[2])
+		}
+		mss := m.sorted(key)
+		if cmd == "ZPOPMAX" {
+			mss = reversed(mss)
+		}
+		if count < 0 {
+			count = 0
+		}
+		mss = limit(mss, 0, count)
+		m.remove(key, mss)
+		return membersReply(mss, true)
+	case "ZUNIONSTORE", "ZINTERSTORE":
+		return m.store(cmd == "ZINTERSTORE", args)
+	}
+	panic(fmt.Sprintf("unexpected command %q", args))
+}
+
+// store implements ZUNIONSTORE and ZINTERSTORE, a product or a sum which is NaN counts as 0.
+// kvrocks leaves the destination untouched if a source of ZINTERSTORE or all sources of
+// ZUNIONSTORE are empty.
+func (m *zsetModel) store(inter bool, args []string) util.Reply {
+	dst := args[1]
+	numKeys, _ := strconv.Atoi(args[2])
+	keys := args[3 : 3+numKeys]
+	weights := make([]float64, numKeys)
+	for i := range weights {
+		weights[i] = 1
+	}
+	aggregate := "SUM"
+	for i := 3 + numKeys; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "WEIGHTS":
+			for j := range weights {
+				weights[j], _ = strconv.ParseFloat(args[i+1+j], 64)
+			}
+			i += numKeys
+		case "AGGREGATE":
+			aggregate = strings.ToUpper(args[i+1])
+			i++
+		}
+	}
+
+	result := make(map[string]float64)
+	counters := make(map[string]int)
+	for i, key := range keys {
+		if len(m.zsets[key]) == 0 && inter {
+			return util.IntegerReply(0)
+		}
+		for member, score := range m.zsets[key] {
+			score *= weights[i]
+			if math.IsNaN(score) {
+				score = 0
+			}
+			old, ok := result[member]
+			if !ok {
+				if i == 0 || !inter {
+					result[member] = score
+					counters[member] = 1
+				}
+				continue
+			}
+			counters[member]++
+			switch aggregate {
+			case "SUM":
+				if result[member] = old + score; math.IsNaN(result[member]) {
+					result[member] = 0
+				}
+			// unlike math.Min and math.Max, -0 and 0 are equal, and the first one is kept
+			case "MIN":
+				if score < old {
+					result[member] = score
+				}
+			case "MAX":
+				if score > old {
+					result[member] = score
+				}
+			}
+		}
+	}
+	if len(result) == 0 {
+		return util.IntegerReply(0)
+	}
+	if inter {
+		for member := range result {
+			if counters[member] != len(keys) {
+				delete(result, member)
+			}
+		}
+	}
+	m.keys.Remove(dst)
+	if len(result) > 0 {
+		m.zsets[dst] = result
+	}
+	return util.IntegerReply(int64(len(result)))
+}
+
+func (m *zsetModel) StateQueries() [][]string {
+	var queries [][]string
+	for _, key := range zsetModelKeys {
+		queries = append(queries, []string{"ZRANGE", key, "0", "-1", "WITHSCORES"}, []string{"TTL", key})
+	}
+	return queries
+}
+
+// half returns a small multiple of 0.5, so scores are often equal and sums are exact.
+func half() string {
+	return strconv.FormatFloat(float64(util.RandomSignedInt(8))/2, 'f', -1, 64)
+}
+
+// edgeScore returns a score at the limits of doubles: the largest ones, whose sums overflow
+// to infinities, the smallest normal and subnormal ones, -0, and ones which need 17 digits.
+func edgeScore() string {
+	return util.OneOf("1e308", "-1e308", "1.7976931348623157e308", "2.2250738585072014e-308", "5e-324",
+		"-5e-324", "-0", "0.1", "0.2", "0.30000000000000004", "-inf", "+inf")
+}
+
+func isNegativeZero(f float64) bool {
+	return f == 0 && math.Signbit(f)
+}
+
+var knownZSetQuirks = []util.Quirk[*zsetModel]{
+	{
+		// std::stod fails with out_of_range on subnormal numbers
+		Name: "subnormal scores are rejected",
+		Applies: func(m *zsetModel, args []string) bool {
+			var scores []string
+			switch strings.ToUpper(args[0]) {
+			case "ZADD":
+				for i := 2; i+1 < len(args); i += 2 {
+					scores = append(scores, args[i])
+				}
+			case "ZINCRBY":
+				scores = append(scores, args[2])
+			}
+			for _, s := range scores {
+				if f, err := strconv.ParseFloat(s, 64); err == nil && f != 0 && math.Abs(f) < 0x1p-1022 {
+					return true
+				}
+			}
+			return false
+		},
+		Check: func(t *testing.T, do func(args ...string) util.Reply) bool {
+			r := do("ZADD", "zquirk-subnormal", "5e-324", "m")
+			if r.Type == util.ReplyError {
+				return true
+			}
+			require.Equal(t, util.IntegerReply(1), r)
+			require.Equal(t, util.BulkStringReply("4.9406564584124654e-324"), do("ZSCORE", "zquirk-subnormal", "m"))
+			return false
+		},
+	},
+	{
+		// scores are encoded so that -0 sorts below 0 in RocksDB
+		Name: "-0 is ordered below 0 and out of score ranges bounded by 0",
+		Applies: func(m *zsetModel, args []string) bool {
+			after := m.clone()
+			after.Apply(args)
+			for _, zset := range after.zsets {
+				negative, positive := false, false
+				for _, score := range zset {
+					negative = negative || isNegativeZero(score)
+					positive = positive || (score == 0 && !isNegativeZero(score))
+				}
+				if negative && positive {
+					return true
+				}
+			}
+			switch strings.ToUpper(args[0]) {
+			case "ZCOUNT", "ZRANGEBYSCORE", "ZREVRANGEBYSCORE", "ZREMRANGEBYSCORE":
+				hasNegativeZero := false
+				for _, score := range m.zsets[args[1]] {
+					hasNegativeZero = hasNegativeZero || isNegativeZero(score)
+				}
+				for _, bound := range args[2:4] {
+					if f, err := strconv.ParseFloat(strings.TrimPrefix(bound, "("), 64); err == nil && f == 0 && hasNegativeZero {
+						return true
+					}
+				}
+			}
+			return false
+		},
+		Check: func(t *testing.T, do func(args ...string) util.Reply) bool {
+			require.Equal(t, util.IntegerReply(2), do("ZADD", "zquirk-zero", "-0", "b", "0", "a"))
+			r := do("ZRANGE", "zquirk-zero", "0", "-1")
+			count := do("ZCOUNT", "zquirk-zero", "0", "0")
+			if r.Elems[0].Str == "b" || count.Int != 2 {
+				return true
+			}
+			require.Equal(t, util.BulkStringsReply("a", "b"), r)
+			return false
+		},
+	},
+	{
+		// strtod parses an empty number, so "(" is an exclusive bound of 0
+		Name: "an empty score bound after ( is parsed as 0",
+		Applies: func(m *zsetModel, args []string) bool {
+			switch strings.ToUpper(args[0]) {
+			case "ZCOUNT", "ZRANGEBYSCORE", "ZREVRANGEBYSCORE", "ZREMRANGEBYSCORE":
+				return slices.Contains(args[2:4], "(")
+			}
+			return false
+		},
+		Check: func(t *testing.T, do func(args ...string) util.Reply) bool {
+			r := do("ZCOUNT", "zquirk-bound", "(", "+inf")
+			if r.Type != util.ReplyError {
+				return true
+			}
+			require.Equal(t, util.ErrorReply("ERR min or max is not a float"), r)
+			return false
+		},
+	},
+	{
+		// the offset is only applied when it's not negative
+		Name: "a negative LIMIT offset doesn't skip any member",
+		Applies: func(m *zsetModel, args []string) bool {
+			offset, _, ok := limitArgs(args)
+			return ok && offset < 0
+		},
+		Check: func(t *testing.T, do func(args ...string) util.Reply) bool {
+			require.Equal(t, util.IntegerReply(2), do("ZADD", "zquirk-offset", "1", "a", "1", "b"))
+			r := do("ZRANGEBYSCORE", "zquirk-offset", "-inf", "+inf", "LIMIT", "-1", "1")
+			if len(r.Elems) > 0 {
+				return true
+			}
+			require.Equal(t, util.BulkStringsReply(), r)
+			require.Equal(t, util.BulkStringsReply(), do("ZRANGEBYLEX", "zquirk-offset", "-", "+", "LIMIT", "-1", "1"))
+			return false
+		},
+	},
+	{
+		// RangeByScore only limits the members by a positive count
+		Name: "a zero LIMIT count doesn't limit a score range",
+		Applies: func(m *zsetModel, args []string) bool {
+			_, count, ok := limitArgs(args)
+			return ok && count == 0 && strings.HasSuffix(strings.ToUpper(args[0]), "BYSCORE")
+		},
+		Check: func(t *testing.T, do func(args ...string) util.Reply) bool {
+			require.Equal(t, util.IntegerReply(2), do("ZADD", "zquirk-count", "1", "a", "1", "b"))
+			r := do("ZRANGEBYSCORE", "zquirk-count", "-inf", "+inf", "LIMIT", "0", "0")
+			if len(r.Elems) > 0 {
+				return true
+			}
+			require.Equal(t, util.BulkStringsReply(), r)
+			return false
+		},
+	},
+	{
+		// each member is looked up before the batch is written, so a repeated member is removed
+		// and counted again, and the size of the zset goes wrong as well
+		Name: "ZREM counts a repeated member more than once",
+		Applies: func(m *zsetModel, args []string) bool {
+			if strings.ToUpper(args[0]) != "ZREM" {
+				return false
+			}
+			seen := make(map[string]bool)
+			for _, member := range args[2:] {
+				if _, ok := m.zsets[args[1]][member]; ok && seen[member] {
+					return true
+				}
+				seen[member] = true
+			}
+			return false
+		},
+		Check: func(t *testing.T, do func(args ...string) util.Reply) bool {
+			require.Equal(t, util.IntegerReply(2), do("ZADD", "zquirk-zrem", "1", "a", "2", "b"))
+			if do("ZREM", "zquirk-zrem", "a", "a").Int != 1 {
+				return true
+			}
+			require.Equal(t, util.IntegerReply(1), do("ZCARD", "zquirk-zrem"))
+			return false
+		},
+	},
+}
+
+// limitArgs returns the offset and the count of the LIMIT of a range command.
+func limitArgs(args []string) (offset, count int, ok bool) {
+	for i := 4; i+2 < len(args); i++ {
+		if strings.EqualFold(args[i], "limit") {
+			offset, _ = strconv.Atoi(args[i+1])
+			count, _ = strconv.Atoi(args[i+2])
+			return offset, count, true
+		}
+	}
+	return 0, 0, false
+}
+
+func (m *zsetModel) clone() *zsetModel {
+	c := newZSetModel().(*zsetModel)
+	for key, zset := range m.zsets {
+		c.zsets[key] = maps.Clone(zset)
+	}
+	return c
+}
+
+// Command returns a random command which doesn't run into a known quirk.
+func (m *zsetModel) Command() []string {
+	return util.AvoidQuirks(m, knownZSetQuirks, m.randomCommand)
+}
+
+func (m *zsetModel) randomCommand() []string {
+	key := func() string { return zsetModelKeys[rand.Intn(len(zsetModelKeys))] }
+	member := func() string { return zsetModelMembers[rand.Intn(len(zsetModelMembers))] }
+	score := func() string { return util.OneOf(half(), half(), half(), edgeScore()) }
+	scoreBound := func() string { return util.OneOf(half(), half(), "("+half(), "(", "-inf", "+inf") }
+	lexBound := func() string { return util.OneOf("-", "+", "["+member(), "("+member()) }
+	rank := func() string { return strconv.FormatInt(util.RandomSignedInt(8), 10) }
+	withScores := func(args []string) []string {
+		if util.RandomBool() {
+			args = append(args, "WITHSCORES")
+		}
+		return args
+	}
+	withLimit := func(args []string) []string {
+		if util.RandomBool() {
+			args = append(args, "LIMIT", strconv.Itoa(rand.Intn(5)-1), util.OneOf("-1", "0", "1", "2", "3"))
+		}
+		return args
+	}
+	k := key()
+	return util.RandPath(
+		func() []string {
+			args := []string{"ZADD", k}
+			for i := rand.Intn(3); i >= 0; i-- {
+				args = append(args, score(), member())
+			}
+			return args
+		},
+		func() []string { return []string{"ZADD", k, util.OneOf("nan", "x"), member()} },
+		func() []string { return []string{"ZINCRBY", k, util.OneOf(half(), half(), edgeScore()), member()} },
+		func() []string { return []string{"ZSCORE", k, member()} },
+		func() []string { return []string{"ZMSCORE", k, member(), member()} },
+		func() []string { return []string{"ZCARD", k} },
+		func() []string { return []string{util.OneOf("ZRANK", "ZREVRANK"), k, member()} },
+		func() []string { return withScores([]string{util.OneOf("ZRANGE", "ZREVRANGE"), k, rank(), rank()}) },
+		func() []string { return []string{"ZCOUNT", k, scoreBound(), scoreBound()} },
+		func() []string {
+			args := []string{util.OneOf("ZRANGEBYSCORE", "ZREVRANGEBYSCORE"), k, scoreBound(), scoreBound()}
+			return withLimit(withScores(args))
+		},
+		func() []string {
+			return withLimit([]string{util.OneOf("ZRANGEBYLEX", "ZREVRANGEBYLEX"), k, lexBound(), lexBound()})
+		},
+		func() []string { return []string{"ZLEXCOUNT", k, lexBound(), lexBound()} },
+		func() []string { return []string{"ZREM", k, member(), member()} },
+		func() []string { return []string{"ZREMRANGEBYRANK", k, rank(), rank()} },
+		func() []string { return []string{"ZREMRANGEBYSCORE", k, scoreBound(), scoreBound()} },
+		func() []string { return []string{"ZREMRANGEBYLEX", k, lexBound(), lexBound()} },
+		func() []string {
+			args := []string{util.OneOf("ZPOPMIN", "ZPOPMAX"), k}
+			if util.RandomBool() {
+				args = append(args, strconv.FormatInt(util.RandomSignedInt(3), 10))
+			}
+			return args
+		},
+		func() []string {
+			// weights are positive, negative ones would mostly turn 0 into -0
+			numKeys := 1 + rand.Intn(3)
+			args := []string{util.OneOf("ZUNIONSTORE", "ZINTERSTORE"), k, strconv.Itoa(numKeys)}
+			for i := 0; i < numKeys; i++ {
+				args = append(args, key())
+			}
+			if util.RandomBool() {
+				args = append(args, "WEIGHTS")
+				for i := 0; i < numKeys; i++ {
+					args = append(args, util.OneOf("1", "2", "0.5", "3"))
+				}
+			}
+			if util.RandomBool() {
+				args = append(args, "AGGREGATE", util.OneOf("SUM", "MIN", "MAX"))
+			}
+			return args
+		},
+		func() []string { return m.keys.Command(k) },
+	)
+}
+
+func TestZSetModel(t *testing.T) {
+	util.RunModel(t, newZSetModel, zsetModelKeys)
+}
+
+func TestZSetFloatScores(t *testing.T) {
+	srv := util.StartServer(t, map[string]string{})
+	defer srv.Close()
+
+	c := srv.NewTCPClient()
+	defer func() { require.NoError(t, c.Close()) }()
+	do := func(args ...string) util.Reply {
+		require.NoError(t, c.WriteArgs(args...))
+		r, err := c.ReadReply()
+		require.NoError(t, err)
+		return r
+	}
+
+	t.Run("ZINCRBY overflows to infinities", func(t *testing.T) {
+		require.Equal(t, util.BulkStringReply("1e+308"), do("ZINCRBY", "zfloat", "1e308", "m"))
+		require.Equal(t, util.BulkStringReply("inf"), do("ZINCRBY", "zfloat", "1e308", "m"))
+		require.Equal(t, util.BulkStringReply("inf"), do("ZSCORE", "zfloat", "m"))
+		require.Equal(t, util.BulkStringReply("-inf"), do("ZINCRBY", "zfloat", "-1.7976931348623157e308", "n"))
+		require.Equal(t, util.BulkStringReply("-inf"), do("ZINCRBY", "zfloat", "-1.7976931348623157e308", "n"))
+	})
+
+	t.Run("ZINCRBY fails if the score would be NaN", func(t *testing.T) {
+		require.Equal(t, util.ReplyError, do("ZINCRBY", "zfloat", "-inf", "m").Type)
+		require.Equal(t, util.BulkStringReply("inf"), do("ZSCORE", "zfloat", "m"))
+		require.Equal(t, util.ReplyError, do("ZINCRBY", "zfloat", "nan", "m").Type)
+		require.Equal(t, util.ReplyError, do("ZADD", "zfloat", "nan", "m").Type)
+		require.Equal(t, util.ReplyError, do("ZINCRBY", "zfloat", "1e309", "m").Type)
+	})
+
+	t.Run("Scores are replied with 17 significant digits", func(t *testing.T) {
+		require.Equal(t, util.BulkStringReply("0.10000000000000001"), do("ZINCRBY", "zfloat", "0.1", "p"))
+		require.Equal(t, util.BulkStringReply("0.30000000000000004"), do("ZINCRBY", "zfloat", "0.2", "p"))
+		require.Equal(t, util.IntegerReply(1), do("ZADD", "zfloat", "2.2250738585072014e-308", "q"))
+		require.Equal(t, util.BulkStringReply("2.2250738585072014e-308"), do("ZSCORE", "zfloat", "q"))
+		require.Equal(t, util.IntegerReply(1), do("ZADD", "zfloat", "-0", "r"))
+		require.Equal(t, util.BulkStringReply("-0"), do("ZSCORE", "zfloat", "r"))
+		require.Equal(t, util.IntegerReply(0), do("ZADD", "zfloat", "0", "r"))
+		require.Equal(t, util.BulkStringReply("-0"), do("ZSCORE", "zfloat", "r"))
+	})
+}
+
+func TestZSetKnownQuirks(t *testing.T) {
+	util.RunQuirkChecks(t, knownZSetQuirks)
+}
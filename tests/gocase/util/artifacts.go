@@ -0,0 +1,168 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package util
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+const rocksDBFilesArtifact = "rocksdb-files.txt"
+
+// saveSnapshot writes the INFO ALL, CLIENT LIST and SLOWLOG replies of the running server
+// to its directory, so that they're archived with the other artifacts. Errors are written
+// instead of the replies, since the server may be the reason why the test failed.
+func (s *KvrocksServer) saveSnapshot() {
+	c := s.NewClientWithOption(&redis.Options{
+		Password:    s.configs["requirepass"],
+		DialTimeout: time.Second,
+		ReadTimeout: 5 * time.Second,
+		MaxRetries:  -1,
+	})
+	defer func() { _ = c.Close() }()
+
+	ctx := context.Background()
+	snapshots := map[string]*redis.Cmd{
+		"info.txt":        c.Do(ctx, "INFO", "ALL"),
+		"client-list.txt": c.Do(ctx, "CLIENT", "LIST"),
+		"slowlog.txt":     c.Do(ctx, "SLOWLOG", "GET", "128"),
+	}
+	for name, cmd := range snapshots {
+		content := fmt.Sprintf("%v\n", cmd.Val())
+		if err := cmd.Err(); err != nil {
+			content = fmt.Sprintf("error: %v\n", err)
+		}
+		path := filepath.Join(s.configs["dir"], name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			s.t.Logf("failed to write %s: %v", path, err)
+		}
+	}
+}
+
+// archiveArtifacts archives the configuration file, the logs, stdout and stderr, the snapshots
+// and a listing of the RocksDB files of the server into the artifacts directory of the test.
+func (s *KvrocksServer) archiveArtifacts(t testing.TB) {
+	root := *artifactsDir
+	if root == "" {
+		root = filepath.Join(*workspace, "artifacts")
+	}
+	dir := s.configs["dir"]
+	path := filepath.Join(root, filepath.FromSlash(t.Name()), filepath.Base(dir)+".tar.gz")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, f.Close()) }()
+	gw := gzip.NewWriter(f)
+	defer func() { require.NoError(t, gw.Close()) }()
+	tw := tar.NewWriter(gw)
+	defer func() { require.NoError(t, tw.Close()) }()
+
+	// the regular files of the directory are the configuration file, stdout, stderr, the snapshots
+	// and the logs, the symbolic links to the latest logs are skipped
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var files []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	if logDir := filepath.Dir(s.logs.pattern); logDir != filepath.Clean(dir) {
+		logs, err := filepath.Glob(s.logs.pattern)
+		require.NoError(t, err)
+		files = append(files, logs...)
+	}
+	for _, file := range files {
+		require.NoError(t, addFileToTar(tw, file))
+	}
+
+	listing, err := listRocksDBFiles(dir)
+	require.NoError(t, err)
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Name:    rocksDBFilesArtifact,
+		Mode:    0o644,
+		Size:    int64(len(listing)),
+		ModTime: time.Now(),
+	}))
+	_, err = io.WriteString(tw, listing)
+	require.NoError(t, err)
+
+	t.Logf("the artifacts of the server at %s are archived to %s", s.HostPort(), path)
+}
+
+func addFileToTar(tw *tar.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	// the file may still be growing, e.g. the logs of a server which isn't closed
+	_, err = io.CopyN(tw, f, header.Size)
+	return err
+}
+
+// listRocksDBFiles lists the files in the subdirectories of the server directory, which are
+// the RocksDB database, its checkpoints and backups, with their sizes and modification times.
+func listRocksDBFiles(dir string) (string, error) {
+	var sb strings.Builder
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.ContainsRune(rel, filepath.Separator) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		sb.WriteString(fmt.Sprintf("%s\t%d\t%s\n", rel, info.Size(), info.ModTime().Format(time.RFC3339Nano)))
+		return nil
+	})
+	return sb.String(), err
+}
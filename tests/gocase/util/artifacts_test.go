@@ -0,0 +1,109 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package util
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveArtifacts(t *testing.T) {
+	root := *artifactsDir
+	*artifactsDir = t.TempDir()
+	defer func() { *artifactsDir = root }()
+
+	// a fake server directory, with the logs in it and a RocksDB database and backup
+	dir := filepath.Join(t.TempDir(), "server")
+	files := map[string]string{
+		"kvrocks.conf": "port 6666\n",
+		"stdout":       "out\n",
+		"stderr":       "err\n",
+		"info.txt":     "# Server\n",
+		"kvrocks.host.user.log.INFO.20261017-120000.1": "I20261017 12:00:00.000000 1 main.cc:1] Ready\n",
+		filepath.Join("db", "CURRENT"):                 "MANIFEST-000001\n",
+		filepath.Join("db", "000001.sst"):              "sst",
+		filepath.Join("backup", "meta", "1"):           "meta",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	require.NoError(t, os.Symlink("kvrocks.host.user.log.INFO.20261017-120000.1", filepath.Join(dir, "kvrocks.INFO")))
+
+	configs := map[string]string{"dir": dir}
+	s := &KvrocksServer{
+		t:       t,
+		addr:    &net.TCPAddr{IP: net.IP{127, 0, 0, 1}, Port: 6666},
+		configs: configs,
+		logs:    newLogTailer(configs),
+	}
+	s.archiveArtifacts(t)
+
+	f, err := os.Open(filepath.Join(*artifactsDir, filepath.FromSlash(t.Name()), "server.tar.gz"))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, f.Close()) }()
+	gr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	tr := tar.NewReader(gr)
+	entries := make(map[string]string)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		entries[header.Name] = string(content)
+	}
+
+	// the regular files of the directory are archived, without the symbolic link and the subdirectories
+	for name, content := range files {
+		if strings.ContainsRune(name, filepath.Separator) {
+			require.NotContains(t, entries, name)
+		} else {
+			require.Equal(t, content, entries[name], name)
+		}
+	}
+	require.NotContains(t, entries, "kvrocks.INFO")
+	require.Len(t, entries, 6)
+
+	// the files of the subdirectories are listed with their sizes
+	var listed []string
+	for _, line := range strings.Split(strings.TrimSuffix(entries[rocksDBFilesArtifact], "\n"), "\n") {
+		fields := strings.Split(line, "\t")
+		require.Len(t, fields, 3, line)
+		listed = append(listed, fields[0]+" "+fields[1])
+	}
+	require.ElementsMatch(t, []string{
+		filepath.Join("backup", "meta", "1") + " 4",
+		filepath.Join("db", "000001.sst") + " 3",
+		filepath.Join("db", "CURRENT") + " 16",
+	}, listed)
+}
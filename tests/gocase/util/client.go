@@ -56,7 +56,13 @@ func WaitForOffsetSync(t testing.TB, master, slave *redis.Client) {
 	}, 5*time.Second, 100*time.Millisecond)
 }
 
-func SlaveOf(t testing.TB, slave *redis.Client, master *KvrocksServer) {
+// Endpoint is an address that clients or replicas can connect to, e.g. a KvrocksServer or a FaultProxy.
+type Endpoint interface {
+	Host() string
+	Port() uint64
+}
+
+func SlaveOf(t testing.TB, slave *redis.Client, master Endpoint) {
 	require.NoError(t, slave.SlaveOf(context.Background(), master.Host(), fmt.Sprintf("%d", master.Port())).Err())
 }
 
@@ -0,0 +1,502 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+const ClusterSlots = 16384
+
+// SlotRange is an inclusive range of cluster slots.
+type SlotRange struct {
+	Start int
+	Stop  int
+}
+
+func (r SlotRange) String() string {
+	if r.Start == r.Stop {
+		return fmt.Sprintf("%d", r.Start)
+	}
+	return fmt.Sprintf("%d-%d", r.Start, r.Stop)
+}
+
+// ClusterSpec describes the cluster started by StartCluster.
+type ClusterSpec struct {
+	Shards           int
+	ReplicasPerShard int
+	// SlotLayout is indexed by shard. If it is nil, all slots are evenly split across the shards.
+	SlotLayout [][]SlotRange
+	// Configs are applied to every node in addition to `cluster-enabled yes`.
+	Configs map[string]string
+	// Proxied makes nodes talk to each other through the links of a Network,
+	// so that the cluster can be partitioned.
+	Proxied bool
+}
+
+type ClusterNode struct {
+	ID     string
+	Shard  int
+	Master *ClusterNode
+
+	Server *KvrocksServer
+	Client *redis.Client
+
+	cluster *Cluster
+}
+
+func (n *ClusterNode) IsMaster() bool {
+	return n.Master == nil
+}
+
+// Slots returns the slot ranges served by the node in the topology known by the test.
+func (n *ClusterNode) Slots() []SlotRange {
+	var ranges []SlotRange
+	for slot := 0; slot < ClusterSlots; slot++ {
+		if n.cluster.slots[slot] != n {
+			continue
+		}
+		if len(ranges) > 0 && ranges[len(ranges)-1].Stop == slot-1 {
+			ranges[len(ranges)-1].Stop = slot
+		} else {
+			ranges = append(ranges, SlotRange{Start: slot, Stop: slot})
+		}
+	}
+	return ranges
+}
+
+type Cluster struct {
+	t       testing.TB
+	configs map[string]string
+	nodes   []*ClusterNode
+	slots   [ClusterSlots]*ClusterNode
+	version int64
+	network *Network
+}
+
+// StartCluster starts Shards*(1+ReplicasPerShard) servers, assigns node IDs and pushes
+// the same topology with version 1 to every node.
+func StartCluster(t testing.TB, spec ClusterSpec) *Cluster {
+	require.Greater(t, spec.Shards, 0, "a cluster needs at least one shard")
+	require.GreaterOrEqual(t, spec.ReplicasPerShard, 0)
+
+	layout := spec.SlotLayout
+	if layout == nil {
+		layout = EvenSlotLayout(spec.Shards)
+	}
+	require.Len(t, layout, spec.Shards, "slot layout should be given for every shard")
+
+	c := &Cluster{t: t, configs: spec.Configs}
+	// the nodes already started are closed if another one fails to start or to be configured
+	started := false
+	defer func() {
+		if !started {
+			c.Close()
+		}
+	}()
+	if spec.Proxied {
+		c.network = NewNetwork(t)
+	}
+	for shard := 0; shard < spec.Shards; shard++ {
+		master := c.startNode(shard, nil)
+		for _, r := range layout[shard] {
+			c.assignSlots(r, master)
+		}
+		for i := 0; i < spec.ReplicasPerShard; i++ {
+			c.startNode(shard, master)
+		}
+	}
+
+	c.version = 1
+	c.pushTopology()
+	c.WaitForReplicas()
+	started = true
+	return c
+}
+
+func (c *Cluster) startNode(shard int, master *ClusterNode) *ClusterNode {
+	nodeConfigs := map[string]string{"cluster-enabled": "yes"}
+	for k, v := range c.configs {
+		nodeConfigs[k] = v
+	}
+
+	srv := StartServer(c.t, nodeConfigs)
+	n := &ClusterNode{
+		ID:     RandomNodeID(),
+		Shard:  shard,
+		Master: master,
+		Server: srv,
+		Client: srv.NewClient(),
+
+		cluster: c,
+	}
+	c.nodes = append(c.nodes, n)
+	require.NoError(c.t, n.Client.Do(context.Background(), "clusterx", "SETNODEID", n.ID).Err())
+	return n
+}
+
+// EvenSlotLayout splits all cluster slots into n contiguous ranges of nearly equal size.
+func EvenSlotLayout(n int) [][]SlotRange {
+	layout := make([][]SlotRange, 0, n)
+	start := 0
+	for i := 0; i < n; i++ {
+		stop := start + ClusterSlots/n - 1
+		if i < ClusterSlots%n {
+			stop++
+		}
+		layout = append(layout, []SlotRange{{Start: start, Stop: stop}})
+		start = stop + 1
+	}
+	return layout
+}
+
+// RandomNodeID returns a 40 characters hex string which is valid as a kvrocks cluster node ID.
+func RandomNodeID() string {
+	const hexDigits = "0123456789abcdef"
+	b := make([]byte, 40)
+	for i := range b {
+		b[i] = hexDigits[rand.Intn(len(hexDigits))]
+	}
+	return string(b)
+}
+
+func (c *Cluster) Nodes() []*ClusterNode {
+	return c.nodes
+}
+
+func (c *Cluster) Node(i int) *ClusterNode {
+	return c.nodes[i]
+}
+
+func (c *Cluster) Masters() []*ClusterNode {
+	var masters []*ClusterNode
+	for _, n := range c.nodes {
+		if n.IsMaster() {
+			masters = append(masters, n)
+		}
+	}
+	return masters
+}
+
+func (c *Cluster) Master(shard int) *ClusterNode {
+	for _, n := range c.nodes {
+		if n.IsMaster() && n.Shard == shard {
+			return n
+		}
+	}
+	require.FailNow(c.t, fmt.Sprintf("no master of shard %d", shard))
+	return nil
+}
+
+func (c *Cluster) Replicas(shard int) []*ClusterNode {
+	var replicas []*ClusterNode
+	for _, n := range c.nodes {
+		if !n.IsMaster() && n.Shard == shard {
+			replicas = append(replicas, n)
+		}
+	}
+	return replicas
+}
+
+func (c *Cluster) Version() int64 {
+	return c.version
+}
+
+// Topology generates the argument of `clusterx SETNODES` from the current nodes.
+func (c *Cluster) Topology() string {
+	return c.topologyFor(nil)
+}
+
+// topologyFor generates the topology seen by the viewer, in which the addresses
+// of other nodes are the links of the network if the cluster is proxied.
+func (c *Cluster) topologyFor(viewer *ClusterNode) string {
+	var lines []string
+	for _, n := range c.nodes {
+		host, port := c.addrFor(viewer, n)
+		if n.IsMaster() {
+			line := fmt.Sprintf("%s %s %d master -", n.ID, host, port)
+			for _, r := range n.Slots() {
+				line += " " + r.String()
+			}
+			lines = append(lines, line)
+		} else {
+			lines = append(lines, fmt.Sprintf("%s %s %d slave %s", n.ID, host, port, n.Master.ID))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (c *Cluster) addrFor(viewer, n *ClusterNode) (string, uint64) {
+	if c.network == nil || viewer == nil || viewer == n {
+		return n.Server.Host(), n.Server.Port()
+	}
+	l := c.network.Link(viewer.Server, n.Server)
+	return l.Host(), l.Port()
+}
+
+func (c *Cluster) hostPortFor(viewer, n *ClusterNode) string {
+	host, port := c.addrFor(viewer, n)
+	return fmt.Sprintf("%s:%d", host, port)
+}
+
+// SetNodes sends `clusterx SETNODES` with the given topology and version to every node.
+func (c *Cluster) SetNodes(topology string, version int64) {
+	for _, n := range c.nodes {
+		require.NoError(c.t, n.Client.Do(context.Background(), "clusterx", "SETNODES", topology, version).Err())
+	}
+}
+
+func (c *Cluster) pushTopology() {
+	for _, n := range c.nodes {
+		require.NoError(c.t, n.Client.Do(context.Background(), "clusterx", "SETNODES", c.topologyFor(n), c.version).Err())
+	}
+}
+
+func (c *Cluster) assignSlots(r SlotRange, to *ClusterNode) {
+	require.True(c.t, r.Start >= 0 && r.Start <= r.Stop && r.Stop < ClusterSlots, "invalid slot range %s", r)
+	require.True(c.t, to.IsMaster(), "slots can only be assigned to a master")
+	for slot := r.Start; slot <= r.Stop; slot++ {
+		c.slots[slot] = to
+	}
+}
+
+// BumpVersion pushes the current topology to every node with the next version.
+func (c *Cluster) BumpVersion() {
+	c.version++
+	c.pushTopology()
+	c.RequireConverged()
+}
+
+// MoveSlots assigns the slots to the given master. A single slot is moved by
+// `clusterx SETSLOT`, otherwise the whole topology is pushed by `clusterx SETNODES`.
+func (c *Cluster) MoveSlots(r SlotRange, to *ClusterNode) {
+	c.assignSlots(r, to)
+	c.version++
+	if r.Start == r.Stop {
+		for _, n := range c.nodes {
+			require.NoError(c.t, n.Client.Do(context.Background(), "clusterx", "SETSLOT", r.Start, "NODE", to.ID, c.version).Err())
+		}
+	} else {
+		c.pushTopology()
+	}
+	c.RequireConverged()
+}
+
+// AddNode starts a new node and joins it into the cluster. The node is a master
+// of a new shard without any slots if master is nil, otherwise it's a replica of master.
+func (c *Cluster) AddNode(master *ClusterNode) *ClusterNode {
+	shard := 0
+	if master != nil {
+		require.True(c.t, master.IsMaster(), "a replica can only be attached to a master")
+		shard = master.Shard
+	} else {
+		for _, n := range c.nodes {
+			if n.Shard >= shard {
+				shard = n.Shard + 1
+			}
+		}
+	}
+
+	n := c.startNode(shard, master)
+	c.BumpVersion()
+	if master != nil {
+		WaitForSync(c.t, n.Client)
+	}
+	return n
+}
+
+// RemoveNode removes the node from the topology of the rest nodes and then shuts it down.
+// A master can only be removed if it neither serves slots nor has replicas.
+func (c *Cluster) RemoveNode(node *ClusterNode) {
+	if node.IsMaster() {
+		require.Empty(c.t, node.Slots(), "can't remove a master which still serves slots")
+		for _, n := range c.nodes {
+			require.False(c.t, n.Master == node, "can't remove a master which still has replicas")
+		}
+	}
+
+	idx := -1
+	for i, n := range c.nodes {
+		if n == node {
+			idx = i
+		}
+	}
+	require.NotEqual(c.t, -1, idx, "node %s is not in the cluster", node.ID)
+	c.nodes = append(c.nodes[:idx], c.nodes[idx+1:]...)
+
+	c.BumpVersion()
+	require.NoError(c.t, node.Client.Close())
+	node.Server.Close()
+}
+
+// PromoteReplica makes the replica the master of its shard. The slots of the shard
+// are handed over to it and all other nodes of the shard become its replicas.
+func (c *Cluster) PromoteReplica(replica *ClusterNode) {
+	require.False(c.t, replica.IsMaster(), "node %s is already a master", replica.ID)
+
+	old := replica.Master
+	for slot := range c.slots {
+		if c.slots[slot] == old {
+			c.slots[slot] = replica
+		}
+	}
+	for _, n := range c.nodes {
+		if n.Master == old {
+			n.Master = replica
+		}
+	}
+	replica.Master = nil
+	old.Master = replica
+
+	c.BumpVersion()
+}
+
+// RequireConverged checks that every node has accepted the current version and
+// reports the same topology as the one known by the test.
+func (c *Cluster) RequireConverged() {
+	ctx := context.Background()
+	for _, n := range c.nodes {
+		expectedNodes := c.expectedNodes(n)
+		expectedSlots := c.expectedSlots(n)
+
+		version, err := n.Client.Do(ctx, "clusterx", "version").Int64()
+		require.NoError(c.t, err)
+		require.EqualValues(c.t, c.version, version, "node %s has a different cluster version", n.ID)
+
+		nodes, err := n.Client.ClusterNodes(ctx).Result()
+		require.NoError(c.t, err)
+		require.ElementsMatch(c.t, expectedNodes, parseClusterNodes(nodes), "node %s has a different topology", n.ID)
+
+		slots, err := n.Client.ClusterSlots(ctx).Result()
+		require.NoError(c.t, err)
+		require.Len(c.t, slots, len(expectedSlots), "node %s has different cluster slots", n.ID)
+		for i := range slots {
+			require.Equal(c.t, expectedSlots[i].Start, slots[i].Start, "node %s has different cluster slots", n.ID)
+			require.Equal(c.t, expectedSlots[i].End, slots[i].End, "node %s has different cluster slots", n.ID)
+			require.Equal(c.t, expectedSlots[i].Nodes[0], slots[i].Nodes[0], "node %s has different cluster slots", n.ID)
+			require.ElementsMatch(c.t, expectedSlots[i].Nodes, slots[i].Nodes, "node %s has different cluster slots", n.ID)
+		}
+	}
+}
+
+func (c *Cluster) expectedSlots(viewer *ClusterNode) []redis.ClusterSlot {
+	var slots []redis.ClusterSlot
+	for slot := 0; slot < ClusterSlots; slot++ {
+		owner := c.slots[slot]
+		if owner == nil {
+			continue
+		}
+		if slot > 0 && c.slots[slot-1] == owner {
+			slots[len(slots)-1].End = slot
+			continue
+		}
+		nodes := []redis.ClusterNode{{ID: owner.ID, Addr: c.hostPortFor(viewer, owner)}}
+		for _, n := range c.nodes {
+			if n.Master == owner {
+				nodes = append(nodes, redis.ClusterNode{ID: n.ID, Addr: c.hostPortFor(viewer, n)})
+			}
+		}
+		slots = append(slots, redis.ClusterSlot{Start: slot, End: slot, Nodes: nodes})
+	}
+	return slots
+}
+
+func (c *Cluster) expectedNodes(viewer *ClusterNode) []string {
+	var nodes []string
+	for _, n := range c.nodes {
+		if n.IsMaster() {
+			var ranges []string
+			for _, r := range n.Slots() {
+				ranges = append(ranges, r.String())
+			}
+			nodes = append(nodes, strings.TrimSpace(fmt.Sprintf("%s %s master - %s", n.ID, c.hostPortFor(viewer, n), strings.Join(ranges, " "))))
+		} else {
+			nodes = append(nodes, fmt.Sprintf("%s %s slave %s", n.ID, c.hostPortFor(viewer, n), n.Master.ID))
+		}
+	}
+	return nodes
+}
+
+// parseClusterNodes drops the fields of `CLUSTER NODES` which are unrelated to the topology,
+// e.g. the myself flag, the ping/pong timestamps and the link state.
+func parseClusterNodes(s string) []string {
+	var nodes []string
+	for _, line := range strings.Split(strings.TrimSpace(s), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 8 {
+			continue
+		}
+		addr := strings.Split(fields[1], "@")[0]
+		role := strings.TrimPrefix(fields[2], "myself,")
+		node := append([]string{fields[0], addr, role, fields[3]}, fields[8:]...)
+		nodes = append(nodes, strings.Join(node, " "))
+	}
+	return nodes
+}
+
+func (c *Cluster) WaitForReplicas() {
+	for _, n := range c.nodes {
+		if !n.IsMaster() {
+			WaitForSync(c.t, n.Client)
+		}
+	}
+}
+
+// Network returns the network between the nodes, it's nil if the cluster is not proxied.
+func (c *Cluster) Network() *Network {
+	return c.network
+}
+
+// Partition cuts the links between the two groups of nodes, see Network.Partition.
+func (c *Cluster) Partition(groupA, groupB []*ClusterNode) {
+	require.NotNil(c.t, c.network, "only a proxied cluster can be partitioned")
+	c.network.Partition(clusterServers(groupA), clusterServers(groupB))
+}
+
+// Heal restores the links cut by Partition.
+func (c *Cluster) Heal() {
+	require.NotNil(c.t, c.network, "only a proxied cluster can be partitioned")
+	c.network.Heal()
+}
+
+func clusterServers(nodes []*ClusterNode) []*KvrocksServer {
+	servers := make([]*KvrocksServer, 0, len(nodes))
+	for _, n := range nodes {
+		servers = append(servers, n.Server)
+	}
+	return servers
+}
+
+func (c *Cluster) Close() {
+	for _, n := range c.nodes {
+		require.NoError(c.t, n.Client.Close())
+		n.Server.Close()
+	}
+	if c.network != nil {
+		c.network.Close()
+	}
+}
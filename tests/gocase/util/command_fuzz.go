@@ -0,0 +1,178 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slices"
+)
+
+// CommandInfo is an entry of the reply of COMMAND and COMMAND INFO.
+type CommandInfo struct {
+	Name     string
+	Arity    int
+	Flags    []string
+	FirstKey int
+	LastKey  int
+	KeyStep  int
+}
+
+// IsKey reports whether the i-th argument of a command with argc arguments is a key,
+// the command name itself is the 0-th argument.
+func (c CommandInfo) IsKey(i, argc int) bool {
+	if c.FirstKey <= 0 || c.KeyStep <= 0 || i < c.FirstKey {
+		return false
+	}
+	last := c.LastKey
+	if last < 0 {
+		last += argc
+	}
+	return i <= last && (i-c.FirstKey)%c.KeyStep == 0
+}
+
+// CommandTable returns the info of all commands supported by the server sorted by name.
+func CommandTable(t testing.TB, rdb *redis.Client) []CommandInfo {
+	vs, err := rdb.Do(context.Background(), "COMMAND").Slice()
+	require.NoError(t, err)
+
+	commands := make([]CommandInfo, 0, len(vs))
+	for _, v := range vs {
+		entry, ok := v.([]interface{})
+		require.True(t, ok, "unexpected command entry %v", v)
+		require.Len(t, entry, 6)
+
+		info := CommandInfo{
+			Name:     entry[0].(string),
+			Arity:    int(entry[1].(int64)),
+			FirstKey: int(entry[3].(int64)),
+			LastKey:  int(entry[4].(int64)),
+			KeyStep:  int(entry[5].(int64)),
+		}
+		for _, flag := range entry[2].([]interface{}) {
+			info.Flags = append(info.Flags, flag.(string))
+		}
+		commands = append(commands, info)
+	}
+	slices.SortFunc(commands, func(a, b CommandInfo) bool { return a.Name < b.Name })
+	return commands
+}
+
+// Arguments which are meaningful to some commands, so that the generated
+// vectors reach deeper than the argument parsing.
+var fuzzTokens = []string{
+	"WITHSCORES", "LIMIT", "COUNT", "MATCH", "NX", "XX", "GT", "LT", "CH", "INCR",
+	"EX", "PX", "EXAT", "PXAT", "KEEPTTL", "GET", "BYSCORE", "BYLEX", "REV",
+	"BEFORE", "AFTER", "LEFT", "RIGHT", "AND", "OR", "XOR", "NOT", "BIT", "BYTE",
+	"MAXLEN", "MINID", "NOMKSTREAM", "STREAMS", "STREAM", "FULL", "ASC", "DESC",
+	"STORE", "STOREDIST", "WITHCOORD", "WITHDIST", "WITHHASH", "m", "km", "mi", "ft",
+	"WEIGHTS", "AGGREGATE", "SUM", "MIN", "MAX",
+	"+", "-", "*", "$", "~", "=", "(1", "[a", "(", "[", "-inf", "+inf", "inf", "nan",
+	"0-0", "0-1", "1-*", "18446744073709551615-18446744073709551615",
+}
+
+var fuzzNumbers = []string{
+	"0", "1", "-1", "2", "3", "10", "-10", "100", "-100", "1000",
+	"2147483647", "2147483648", "4294967295", "4294967296",
+	"9223372036854775807", "-9223372036854775808", "9223372036854775808", "18446744073709551616",
+	"0.5", "-1.5", "1e308", "-1e308", "1e-308", "0x10", "1e", "",
+}
+
+// CommandFuzzer generates random argument vectors for the commands from CommandTable.
+// The keys are picked from a small set holding a value of every type and a missing key,
+// so that the commands run against existing keys of both the right and wrong types.
+type CommandFuzzer struct {
+	prefix string
+	Keys   []string
+}
+
+func NewCommandFuzzer(prefix string) *CommandFuzzer {
+	f := &CommandFuzzer{prefix: prefix}
+	for _, typ := range []string{"string", "hash", "list", "set", "zset", "sortedint", "stream", "bitmap", "none"} {
+		f.Keys = append(f.Keys, prefix+":"+typ)
+	}
+	return f
+}
+
+// Populate resets the keys of the fuzzer to hold a small value of their types.
+func (f *CommandFuzzer) Populate(t testing.TB, rdb *redis.Client) {
+	ctx := context.Background()
+	key := func(typ string) string { return f.prefix + ":" + typ }
+	require.NoError(t, rdb.Del(ctx, f.Keys...).Err())
+	require.NoError(t, rdb.Set(ctx, key("string"), "12", 0).Err())
+	require.NoError(t, rdb.HSet(ctx, key("hash"), "a", "1", "b", "2.5", "c", "x").Err())
+	require.NoError(t, rdb.RPush(ctx, key("list"), "a", "1", "b", "a").Err())
+	require.NoError(t, rdb.SAdd(ctx, key("set"), "a", "1", "b").Err())
+	require.NoError(t, rdb.ZAdd(ctx, key("zset"),
+		redis.Z{Score: 1, Member: "a"}, redis.Z{Score: 1, Member: "b"}, redis.Z{Score: 2.5, Member: "c"}).Err())
+	require.NoError(t, rdb.Do(ctx, "SIADD", key("sortedint"), 1, 2, 10).Err())
+	require.NoError(t, rdb.XAdd(ctx, &redis.XAddArgs{Stream: key("stream"), ID: "1-1", Values: []string{"a", "1"}}).Err())
+	require.NoError(t, rdb.SetBit(ctx, key("bitmap"), 10, 1).Err())
+}
+
+// Args returns a random argument vector of the command including its name. Most vectors
+// respect the arity and the key positions of the command, the others violate them.
+func (f *CommandFuzzer) Args(cmd CommandInfo) []string {
+	argc := cmd.Arity
+	if argc < 0 {
+		argc = -argc + rand.Intn(4)
+	}
+	if rand.Intn(10) == 0 {
+		if cmd.Arity > 0 && RandomBool() {
+			argc++
+		} else if argc > 1 {
+			argc--
+		}
+	}
+
+	args := []string{strings.ToUpper(cmd.Name)}
+	for i := 1; i < argc; i++ {
+		if cmd.IsKey(i, argc) && rand.Intn(10) != 0 {
+			args = append(args, f.Key())
+		} else {
+			args = append(args, f.Value())
+		}
+	}
+	return args
+}
+
+func (f *CommandFuzzer) Key() string {
+	return f.Keys[rand.Intn(len(f.Keys))]
+}
+
+// Value returns a random non-key argument, it's a key sometimes since
+// the key positions of some commands are not described by COMMAND INFO.
+func (f *CommandFuzzer) Value() string {
+	return RandPath(
+		f.Key,
+		func() string { return fuzzTokens[rand.Intn(len(fuzzTokens))] },
+		func() string { return fuzzNumbers[rand.Intn(len(fuzzNumbers))] },
+		func() string { return strconv.FormatFloat(rand.NormFloat64()*100, 'f', -1, 64) },
+		func() string { return fmt.Sprintf("%d", RandomSignedInt(1000)) },
+		RandomValue,
+	)
+}
@@ -0,0 +1,158 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var configEscapes = map[byte]byte{'\'': '\'', '"': '"', '\\': '\\', 't': '\t', 'r': '\r', 'n': '\n', 'v': '\v', 'f': '\f', 'b': '\b'}
+
+// parseConfigLine parses a line of kvrocks.conf like ParseConfigLine of config_util.cc, the key
+// is empty for a blank or comment line.
+func parseConfigLine(line string) (string, string, error) {
+	line = strings.TrimLeft(line, " \t\r\n\v\f")
+	if line == "" || line[0] == '#' {
+		return "", "", nil
+	}
+	end := strings.IndexAny(line, " \t\r\n\v\f#")
+	if end < 0 {
+		return line, "", nil
+	}
+	key, rest := line[:end], line[end:]
+	if rest[0] == '#' {
+		return key, "", nil
+	}
+	rest = strings.TrimLeft(rest, " \t\r\n\v\f")
+	if rest == "" || rest[0] == '#' {
+		return key, "", nil
+	}
+	if rest[0] != '"' && rest[0] != '\'' {
+		if i := strings.IndexByte(rest, '#'); i >= 0 {
+			rest = rest[:i]
+		}
+		return key, strings.TrimRight(rest, " \t\r\n\v\f\b"), nil
+	}
+
+	var value []byte
+	for i := 1; i < len(rest); i++ {
+		switch c := rest[i]; {
+		case c == '\\' && i+1 < len(rest):
+			i++
+			if e, ok := configEscapes[rest[i]]; ok {
+				value = append(value, e)
+			}
+		case c == '\\':
+			return "", "", fmt.Errorf("config line ends unexpectedly in quoted string: %q", line)
+		case c == rest[0]:
+			if after := strings.TrimLeft(rest[i+1:], " \t\r\n\v\f"); after != "" && after[0] != '#' {
+				return "", "", fmt.Errorf("more than 2 item in config line: %q", line)
+			}
+			return key, string(value), nil
+		default:
+			value = append(value, c)
+		}
+	}
+	return "", "", fmt.Errorf("config line ends unexpectedly in quoted string: %q", line)
+}
+
+var configEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `"`, `\"`, "\t", `\t`, "\r", `\r`, "\n", `\n`, "\v", `\v`, "\f", `\f`, "\b", `\b`)
+
+// dumpConfigLine formats a line of kvrocks.conf like DumpConfigLine of config_util.cc.
+func dumpConfigLine(key, value string) string {
+	if value == "" {
+		return key + ` ""`
+	}
+	if !strings.ContainsAny(value, " \t\r\n\v\f\"'#") {
+		return key + " " + value
+	}
+	return key + ` "` + configEscaper.Replace(value) + `"`
+}
+
+func (s *KvrocksServer) configFilePath() string {
+	return filepath.Join(s.configs["dir"], "kvrocks.conf")
+}
+
+// ReadConfigFile parses the configuration file of the server, e.g. to check what CONFIG REWRITE
+// persisted. Keys are lower case, and a key given more than once, like rename-command, keeps its
+// last value.
+func (s *KvrocksServer) ReadConfigFile(t testing.TB) map[string]string {
+	content, err := os.ReadFile(s.configFilePath())
+	require.NoError(t, err)
+	configs := make(map[string]string)
+	for _, line := range strings.Split(string(content), "\n") {
+		key, value, err := parseConfigLine(line)
+		require.NoError(t, err)
+		if key != "" {
+			configs[strings.ToLower(key)] = value
+		}
+	}
+	return configs
+}
+
+// rewriteConfigFile replaces the values of the overridden keys in the configuration file, or
+// appends them, like CONFIG REWRITE does. An empty value removes the key.
+func (s *KvrocksServer) rewriteConfigFile(overrides map[string]string) {
+	content, err := os.ReadFile(s.configFilePath())
+	require.NoError(s.t, err)
+	lowered := make(map[string]string, len(overrides))
+	remaining := make(map[string]string, len(overrides))
+	for k, v := range overrides {
+		lowered[strings.ToLower(k)] = v
+		remaining[strings.ToLower(k)] = v
+		if v == "" {
+			delete(s.configs, strings.ToLower(k))
+		} else {
+			s.configs[strings.ToLower(k)] = v
+		}
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+		key, _, err := parseConfigLine(line)
+		require.NoError(s.t, err)
+		key = strings.ToLower(key)
+		if _, ok := lowered[key]; key == "" || !ok {
+			lines = append(lines, line)
+		} else if value, ok := remaining[key]; ok && value != "" {
+			// a key given more than once is only kept once
+			lines = append(lines, dumpConfigLine(key, value))
+			delete(remaining, key)
+		}
+	}
+	keys := make([]string, 0, len(remaining))
+	for k := range remaining {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v := remaining[k]; v != "" {
+			lines = append(lines, dumpConfigLine(k, v))
+		}
+	}
+	require.NoError(s.t, os.WriteFile(s.configFilePath(), []byte(strings.Join(lines, "\n")+"\n"), 0o644))
+}
@@ -0,0 +1,102 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfigLine(t *testing.T) {
+	for _, c := range []struct {
+		line, key, value string
+	}{
+		{"", "", ""},
+		{"  # port 6666", "", ""},
+		{"port 6666", "port", "6666"},
+		{"\tport   6666  ", "port", "6666"},
+		{"port 6666 # the port", "port", "6666"},
+		{"port 6666# the port", "port", "6666"},
+		{"daemonize", "daemonize", ""},
+		{"daemonize#no", "daemonize", ""},
+		{`dir "/tmp/a b"`, "dir", "/tmp/a b"},
+		{`requirepass "a#b" # the password`, "requirepass", "a#b"},
+		{`requirepass 'it\'s'`, "requirepass", "it's"},
+		{`requirepass "a\"b\\c\td\n"`, "requirepass", "a\"b\\c\td\n"},
+		{`requirepass ""`, "requirepass", ""},
+	} {
+		key, value, err := parseConfigLine(c.line)
+		require.NoError(t, err, c.line)
+		require.Equal(t, c.key, key, c.line)
+		require.Equal(t, c.value, value, c.line)
+	}
+
+	for _, line := range []string{`dir "/tmp`, `dir "/tmp\`, `dir "/tmp" /var`} {
+		_, _, err := parseConfigLine(line)
+		require.Error(t, err, line)
+	}
+}
+
+func TestDumpConfigLine(t *testing.T) {
+	require.Equal(t, "port 6666", dumpConfigLine("port", "6666"))
+	require.Equal(t, `requirepass ""`, dumpConfigLine("requirepass", ""))
+	require.Equal(t, `dir "/tmp/a b"`, dumpConfigLine("dir", "/tmp/a b"))
+
+	for _, value := range []string{"", "6666", "/tmp/a b", "a#b", "it's", `say "hi"`, `back\slash`, "tab\tcr\rnl\n\v\f\b"} {
+		key, parsed, err := parseConfigLine(dumpConfigLine("requirepass", value))
+		require.NoError(t, err, value)
+		require.Equal(t, "requirepass", key)
+		require.Equal(t, value, parsed)
+	}
+}
+
+func TestRewriteConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	content := "# the server\n" +
+		"port 6666\n" +
+		"requirepass \"a b\" # the password\n" +
+		"maxclients 10\n" +
+		"bind 127.0.0.1\n" +
+		"maxclients 20\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "kvrocks.conf"), []byte(content), 0o644))
+
+	s := &KvrocksServer{t: t, configs: map[string]string{"dir": dir, "bind": "127.0.0.1"}}
+	s.rewriteConfigFile(map[string]string{
+		"requirepass": "c d#e",
+		"MAXCLIENTS":  "30",
+		"bind":        "",
+		"timeout":     "5",
+		"slaveof":     "",
+	})
+
+	// a repeated key is kept once where it first was, new keys are appended and removed keys dropped
+	rewritten, err := os.ReadFile(filepath.Join(dir, "kvrocks.conf"))
+	require.NoError(t, err)
+	require.Equal(t, "# the server\n"+
+		"port 6666\n"+
+		"requirepass \"c d#e\"\n"+
+		"maxclients 30\n"+
+		"timeout 5\n", string(rewritten))
+	require.Equal(t, map[string]string{"port": "6666", "requirepass": "c d#e", "maxclients": "30", "timeout": "5"}, s.ReadConfigFile(t))
+	require.Equal(t, map[string]string{"dir": dir, "requirepass": "c d#e", "maxclients": "30", "timeout": "5"}, s.configs)
+}
@@ -0,0 +1,224 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package util
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slices"
+)
+
+// Normalizer rewrites the reply to the command before the replies of kvrocks and redis are
+// compared, so that the known and documented differences don't count as a divergence.
+type Normalizer func(args []string, r Reply) Reply
+
+// DefaultNormalizers hide the differences between kvrocks and redis which are by design.
+var DefaultNormalizers = []Normalizer{
+	NormalizeErrors,
+	NormalizeUnordered,
+	NormalizeFloats,
+	NormalizeType,
+	NormalizeObjectEncoding,
+}
+
+// NormalizeErrors ignores the wording of error messages, only the fact that both fail is compared.
+func NormalizeErrors(args []string, r Reply) Reply {
+	if r.Type == ReplyError {
+		return ErrorReply("")
+	}
+	return r
+}
+
+// NormalizeUnordered sorts the replies of the commands whose order is unspecified.
+func NormalizeUnordered(args []string, r Reply) Reply {
+	if r.Type != ReplyArray || r.Nil {
+		return r
+	}
+	switch strings.ToLower(args[0]) {
+	case "smembers", "sunion", "sinter", "sdiff", "hkeys", "hvals", "keys":
+		elems := slices.Clone(r.Elems)
+		slices.SortFunc(elems, func(a, b Reply) bool { return a.String() < b.String() })
+		return ArrayReply(elems...)
+	case "hgetall":
+		pairs := make([][2]Reply, 0, len(r.Elems)/2)
+		for i := 0; i+1 < len(r.Elems); i += 2 {
+			pairs = append(pairs, [2]Reply{r.Elems[i], r.Elems[i+1]})
+		}
+		slices.SortFunc(pairs, func(a, b [2]Reply) bool { return a[0].String() < b[0].String() })
+		elems := make([]Reply, 0, len(r.Elems))
+		for _, p := range pairs {
+			elems = append(elems, p[0], p[1])
+		}
+		return ArrayReply(elems...)
+	}
+	return r
+}
+
+// NormalizeFloats formats the floating point numbers replied as bulk strings with
+// 15 significant digits, since kvrocks and redis format them with different precisions.
+func NormalizeFloats(args []string, r Reply) Reply {
+	switch strings.ToLower(args[0]) {
+	case "incrbyfloat", "hincrbyfloat", "zincrby", "zscore", "zmscore", "zadd":
+	default:
+		if slices.IndexFunc(args, func(arg string) bool { return strings.EqualFold(arg, "withscores") }) < 0 {
+			return r
+		}
+	}
+	return normalizeFloat(r)
+}
+
+func normalizeFloat(r Reply) Reply {
+	switch r.Type {
+	case ReplyBulkString:
+		if f, err := strconv.ParseFloat(r.Str, 64); err == nil && !r.Nil {
+			return BulkStringReply(strconv.FormatFloat(f, 'g', 15, 64))
+		}
+	case ReplyArray:
+		if r.Nil {
+			return r
+		}
+		elems := make([]Reply, 0, len(r.Elems))
+		for _, e := range r.Elems {
+			elems = append(elems, normalizeFloat(e))
+		}
+		return ArrayReply(elems...)
+	}
+	return r
+}
+
+// NormalizeType maps the types only kvrocks has to the redis type with the same
+// commands, and ignores that kvrocks replies TYPE with a bulk string.
+func NormalizeType(args []string, r Reply) Reply {
+	if !strings.EqualFold(args[0], "type") || (r.Type != ReplyBulkString && r.Type != ReplySimpleString) {
+		return r
+	}
+	if r.Str == "bitmap" {
+		return SimpleStringReply("string")
+	}
+	return SimpleStringReply(r.Str)
+}
+
+// NormalizeObjectEncoding ignores the reply of OBJECT ENCODING, kvrocks has no such encodings.
+func NormalizeObjectEncoding(args []string, r Reply) Reply {
+	if len(args) >= 2 && strings.EqualFold(args[0], "object") && strings.EqualFold(args[1], "encoding") {
+		return NullReply()
+	}
+	return r
+}
+
+// Differ sends the same commands to kvrocks and redis and requires their normalized
+// replies to be equal. On the first divergence the test fails with a minimal sequence
+// of commands reproducing it, which is found by replaying the history on empty servers.
+type Differ struct {
+	t           testing.TB
+	kvrocks     *TCPClient
+	redis       *TCPClient
+	normalizers []Normalizer
+	history     [][]string
+}
+
+// NewDiffer flushes both servers and returns a Differ comparing them with the normalizers,
+// DefaultNormalizers are used if none is given.
+func NewDiffer(t testing.TB, kvrocks *KvrocksServer, redis *RedisServer, normalizers ...Normalizer) *Differ {
+	if len(normalizers) == 0 {
+		normalizers = DefaultNormalizers
+	}
+	d := &Differ{
+		t:           t,
+		kvrocks:     kvrocks.NewTCPClient(),
+		redis:       redis.NewTCPClient(),
+		normalizers: normalizers,
+	}
+	d.flush()
+	return d
+}
+
+// Do runs the command on both servers and fails the test if the replies diverge.
+func (d *Differ) Do(args ...string) {
+	d.history = append(d.history, args)
+	k, r := d.do(args)
+	if reflect.DeepEqual(k, r) {
+		return
+	}
+
+	reproducer := d.minimize(d.history)
+	var sb strings.Builder
+	for _, cmd := range reproducer {
+		sb.WriteString("  " + formatArgs(cmd) + "\n")
+	}
+	require.Failf(d.t, "kvrocks diverges from redis",
+		"command: %s\nkvrocks:\n%s\nredis:\n%s\nminimal reproducer on empty servers:\n%s",
+		formatArgs(args), k, r, sb.String())
+}
+
+func (d *Differ) do(args []string) (Reply, Reply) {
+	require.NoError(d.t, d.kvrocks.WriteArgs(args...))
+	require.NoError(d.t, d.redis.WriteArgs(args...))
+	k, err := d.kvrocks.ReadReply()
+	require.NoError(d.t, err)
+	r, err := d.redis.ReadReply()
+	require.NoError(d.t, err)
+	for _, n := range d.normalizers {
+		k, r = n(args, k), n(args, r)
+	}
+	return k, r
+}
+
+func (d *Differ) flush() {
+	require.NoError(d.t, d.kvrocks.WriteArgs("FLUSHALL"))
+	d.kvrocks.MustReadReply(d.t, SimpleStringReply("OK"))
+	require.NoError(d.t, d.redis.WriteArgs("FLUSHALL"))
+	d.redis.MustReadReply(d.t, SimpleStringReply("OK"))
+}
+
+// replay runs the commands on empty servers and returns the index of the first diverging one, or -1.
+func (d *Differ) replay(cmds [][]string) int {
+	d.flush()
+	for i, cmd := range cmds {
+		if k, r := d.do(cmd); !reflect.DeepEqual(k, r) {
+			return i
+		}
+	}
+	return -1
+}
+
+// minimize shrinks the history as long as the last command is still the first one diverging.
+func (d *Differ) minimize(cmds [][]string) [][]string {
+	return ShrinkCommands(cmds, func(cmds [][]string) bool {
+		return d.replay(cmds) == len(cmds)-1
+	})
+}
+
+func (d *Differ) Close() {
+	require.NoError(d.t, d.kvrocks.Close())
+	require.NoError(d.t, d.redis.Close())
+}
+
+func formatArgs(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted = append(quoted, strconv.Quote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
@@ -23,9 +23,14 @@ import "flag"
 
 var binPath = flag.String("binPath", "", "directory including kvrocks build files")
 var workspace = flag.String("workspace", "", "directory of cases workspace")
-var deleteOnExit = flag.Bool("deleteOnExit", false, "whether to delete workspace on exit")
+var deleteOnExit = flag.Bool("deleteOnExit", false, "whether to delete the workspace of a failed test once it's archived, the workspace of a passed test is always deleted")
+var artifactsDir = flag.String("artifactsDir", "", "directory of the artifacts archived when a test fails, it's the artifacts directory in the workspace by default")
 var cliPath = flag.String("cliPath", "redis-cli", "path to redis-cli")
 var tlsEnable = flag.Bool("tlsEnable", false, "enable TLS-related test cases")
+var redisServerPath = flag.String("redisServerPath", "", "path to redis-server, differential test cases are skipped if it's not set")
+var randSeed = flag.Int64("randSeed", 0, "seed of randomized test cases, a random seed is picked if it's 0")
+var resourceSampleInterval = flag.Duration("resourceSampleInterval", 0, "interval of sampling the resource usage of every server, it's disabled if it's 0")
+var logTailLines = flag.Int("logTailLines", 50, "number of the last log lines of every server dumped when a test fails")
 
 func CLIPath() string {
 	return *cliPath
@@ -0,0 +1,555 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package util
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Operation is a command of a concurrent history.
+type Operation struct {
+	Client int
+	Args   []string
+	Reply  Reply
+	// Call and Return are the times since the beginning of the history when the command
+	// was sent and when its reply was read.
+	Call, Return time.Duration
+	// Lost is set when the reply couldn't be read, the command may or may not have taken effect.
+	Lost bool
+	// Replica is set for the reads sent to a replica, which aren't expected to be linearizable.
+	Replica bool
+}
+
+func (op Operation) String() string {
+	if op.Lost {
+		return fmt.Sprintf("%sclient %d [%v, ...] %s -> lost", op.server(), op.Client, op.Call, formatArgs(op.Args))
+	}
+	return fmt.Sprintf("%sclient %d [%v, %v] %s -> %s", op.server(), op.Client, op.Call, op.Return,
+		formatArgs(op.Args), strings.TrimSpace(op.Reply.String()))
+}
+
+func (op Operation) server() string {
+	if op.Replica {
+		return "replica "
+	}
+	return ""
+}
+
+// History records the commands sent by concurrent clients.
+type History struct {
+	start time.Time
+
+	mu  sync.Mutex
+	ops []Operation
+}
+
+func NewHistory() *History {
+	return &History{start: time.Now()}
+}
+
+// Do sends the command and reads its reply on the client, and records it.
+func (h *History) Do(client int, c *TCPClient, args ...string) (Reply, error) {
+	return h.do(Operation{Client: client, Args: args}, c)
+}
+
+// DoReplica is Do on a client of a replica.
+func (h *History) DoReplica(client int, c *TCPClient, args ...string) (Reply, error) {
+	return h.do(Operation{Client: client, Args: args, Replica: true}, c)
+}
+
+func (h *History) do(op Operation, c *TCPClient) (Reply, error) {
+	op.Call = time.Since(h.start)
+	err := c.WriteArgs(op.Args...)
+	if err == nil {
+		op.Reply, err = c.ReadReply()
+	}
+	op.Return = time.Since(h.start)
+	if err != nil {
+		op.Lost = true
+		op.Return = math.MaxInt64
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ops = append(h.ops, op)
+	return op.Reply, err
+}
+
+// Operations returns the recorded operations.
+func (h *History) Operations() []Operation {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Operation(nil), h.ops...)
+}
+
+// register is the state of a string key.
+type register struct {
+	exists bool
+	value  string
+}
+
+// stepRegister is the sequential specification of GET, SET, CAS, CAD and INCR. It returns whether
+// the reply is the one of the command run on the state, and the state after it. Lost replies are
+// always valid, and all errors are equivalent.
+func stepRegister(r register, op Operation) (bool, register) {
+	var expected Reply
+	next := r
+	switch strings.ToUpper(op.Args[0]) {
+	case "GET":
+		if !r.exists {
+			expected = NilBulkStringReply()
+		} else {
+			expected = BulkStringReply(r.value)
+		}
+	case "SET":
+		next = register{true, op.Args[2]}
+		expected = SimpleStringReply("OK")
+	case "CAS":
+		if !r.exists {
+			expected = IntegerReply(-1)
+		} else if r.value != op.Args[2] {
+			expected = IntegerReply(0)
+		} else {
+			next = register{true, op.Args[3]}
+			expected = IntegerReply(1)
+		}
+	case "CAD":
+		if !r.exists {
+			expected = IntegerReply(-1)
+		} else if r.value != op.Args[2] {
+			expected = IntegerReply(0)
+		} else {
+			next = register{}
+			expected = IntegerReply(1)
+		}
+	case "INCR":
+		n, err := int64(0), error(nil)
+		if r.exists {
+			n, err = strconv.ParseInt(r.value, 10, 64)
+		}
+		if err != nil || n == math.MaxInt64 {
+			expected = ErrorReply("")
+		} else {
+			next = register{true, strconv.FormatInt(n+1, 10)}
+			expected = IntegerReply(n + 1)
+		}
+	default:
+		panic(fmt.Sprintf("unexpected command %q", op.Args))
+	}
+	if op.Lost {
+		return true, next
+	}
+	actual := op.Reply
+	if actual.Type == ReplyError {
+		actual = ErrorReply("")
+	}
+	return reflect.DeepEqual(expected, actual), next
+}
+
+// linearizationEntry is the call or the return of an operation in the doubly linked list
+// of events searched by checkKeyLinearizable.
+type linearizationEntry struct {
+	op         int
+	call       bool
+	match      *linearizationEntry
+	prev, next *linearizationEntry
+}
+
+func (e *linearizationEntry) lift() {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	e.match.prev.next = e.match.next
+	if e.match.next != nil {
+		e.match.next.prev = e.match.prev
+	}
+}
+
+func (e *linearizationEntry) unlift() {
+	e.match.prev.next = e.match
+	if e.match.next != nil {
+		e.match.next.prev = e.match
+	}
+	e.prev.next = e
+	e.next.prev = e
+}
+
+type linearizedSet []uint64
+
+func (s linearizedSet) with(i int) linearizedSet {
+	c := append(linearizedSet(nil), s...)
+	c[i/64] |= 1 << (i % 64)
+	return c
+}
+
+func (s linearizedSet) hash() uint64 {
+	h := uint64(14695981039346656037)
+	for _, w := range s {
+		h = (h ^ w) * 1099511628211
+	}
+	return h
+}
+
+// checkKeyLinearizable searches a linearization of the operations on a single key, from
+// a missing key. It's the algorithm of Wing and Gong, with the memoization of Lowe: a
+// call is linearized as soon as the model accepts it, and the search backtracks when it
+// reaches the return of an operation which isn't linearized yet, skipping the states
+// which are already known to lead nowhere.
+func checkKeyLinearizable(ops []Operation) bool {
+	events := make([]*linearizationEntry, 0, 2*len(ops))
+	for i := range ops {
+		call := &linearizationEntry{op: i, call: true}
+		ret := &linearizationEntry{op: i, match: call}
+		call.match = ret
+		events = append(events, call, ret)
+	}
+	at := func(e *linearizationEntry) time.Duration {
+		if e.call {
+			return ops[e.op].Call
+		}
+		return ops[e.op].Return
+	}
+	// calls go before returns at the same time, so that such operations are concurrent
+	sort.SliceStable(events, func(i, j int) bool {
+		if ti, tj := at(events[i]), at(events[j]); ti != tj {
+			return ti < tj
+		}
+		return events[i].call && !events[j].call
+	})
+	head := &linearizationEntry{}
+	prev := head
+	for _, e := range events {
+		e.prev, prev.next = prev, e
+		prev = e
+	}
+
+	type frame struct {
+		entry      *linearizationEntry
+		linearized linearizedSet
+		state      register
+	}
+	type cached struct {
+		linearized linearizedSet
+		state      register
+	}
+	cache := make(map[uint64][]cached)
+	var stack []frame
+	state := register{}
+	linearized := make(linearizedSet, (len(ops)+63)/64)
+	entry := head.next
+	for head.next != nil {
+		if entry.call {
+			if ok, next := stepRegister(state, ops[entry.op]); ok {
+				candidate := linearized.with(entry.op)
+				h := candidate.hash()
+				seen := false
+				for _, c := range cache[h] {
+					if c.state == next && reflect.DeepEqual(c.linearized, candidate) {
+						seen = true
+						break
+					}
+				}
+				if !seen {
+					cache[h] = append(cache[h], cached{candidate, next})
+					stack = append(stack, frame{entry, linearized, state})
+					state, linearized = next, candidate
+					entry.lift()
+					entry = head.next
+					continue
+				}
+			}
+			entry = entry.next
+			continue
+		}
+		if len(stack) == 0 {
+			return false
+		}
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		state, linearized = top.state, top.linearized
+		top.entry.unlift()
+		entry = top.entry.next
+	}
+	return true
+}
+
+// CheckLinearizable checks that the operations behave as if each one took effect atomically
+// at some point between its call and its return, on keys which are missing at the beginning.
+// Keys are independent, so they are checked one by one, and the operations of the first key
+// which can't be linearized are returned, or nil. The reads of replicas are left to
+// CheckReplicaReads.
+func CheckLinearizable(ops []Operation) []Operation {
+	byKey := make(map[string][]Operation)
+	var keys []string
+	for _, op := range ops {
+		if op.Replica {
+			continue
+		}
+		key := op.Args[1]
+		if _, ok := byKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		byKey[key] = append(byKey[key], op)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !checkKeyLinearizable(byKey[key]) {
+			return byKey[key]
+		}
+	}
+	return nil
+}
+
+// RequireLinearizable fails the test with the operations of a key if they can't be linearized.
+func RequireLinearizable(t testing.TB, ops []Operation) {
+	violation := CheckLinearizable(ops)
+	if violation == nil {
+		return
+	}
+	sort.Slice(violation, func(i, j int) bool { return violation[i].Call < violation[j].Call })
+	var sb strings.Builder
+	for _, op := range violation {
+		sb.WriteString("  " + op.String() + "\n")
+	}
+	require.Failf(t, "history isn't linearizable", "operations on %s:\n%s", violation[0].Args[1], sb.String())
+}
+
+// replicaWrite is an operation of the master which may have left a key in a state.
+type replicaWrite struct {
+	op    Operation
+	state register
+	// anyInteger is set for a lost INCR, which may have left the key at any integer.
+	anyInteger bool
+}
+
+func (w replicaWrite) leaves(r register) bool {
+	if w.anyInteger {
+		_, err := strconv.ParseInt(r.value, 10, 64)
+		return r.exists && err == nil
+	}
+	return w.state == r
+}
+
+// replicaWrites returns the writes of the operations of the master on a key, starting from
+// the missing key.
+func replicaWrites(ops []Operation) []replicaWrite {
+	writes := []replicaWrite{{}}
+	for _, op := range ops {
+		succeeded := op.Lost || (op.Reply.Type == ReplyInteger && op.Reply.Int == 1)
+		switch strings.ToUpper(op.Args[0]) {
+		case "SET":
+			writes = append(writes, replicaWrite{op: op, state: register{true, op.Args[2]}})
+		case "CAS":
+			if succeeded {
+				writes = append(writes, replicaWrite{op: op, state: register{true, op.Args[3]}})
+			}
+		case "CAD":
+			if succeeded {
+				writes = append(writes, replicaWrite{op: op})
+			}
+		case "INCR":
+			if op.Lost {
+				writes = append(writes, replicaWrite{op: op, anyInteger: true})
+			} else if op.Reply.Type == ReplyInteger {
+				writes = append(writes, replicaWrite{op: op, state: register{true, strconv.FormatInt(op.Reply.Int, 10)}})
+			}
+		}
+	}
+	return writes
+}
+
+// checkKeyReplicaReads checks the reads of the replicas on a key against the operations of the
+// master, see CheckReplicaReads.
+func checkKeyReplicaReads(master, reads []Operation) ([]Operation, string) {
+	writes := replicaWrites(master)
+	// sources are the writes which may have left the key in the state read, they're
+	// called before the read returns
+	sources := make([][]replicaWrite, len(reads))
+	states := make([]register, len(reads))
+	for i, read := range reads {
+		if read.Lost || read.Reply.Type != ReplyBulkString {
+			continue
+		}
+		states[i] = register{!read.Reply.Nil, read.Reply.Str}
+		for _, w := range writes {
+			if w.op.Call <= read.Return && w.leaves(states[i]) {
+				sources[i] = append(sources[i], w)
+			}
+		}
+		if len(sources[i]) == 0 {
+			return []Operation{read}, "the master never had the state read before the read returned"
+		}
+	}
+	// a state is older than another if all of its writes returned before any write of the other
+	// was called, it can't be read by a client after the other
+	older := func(a, b []replicaWrite) bool {
+		for _, wa := range a {
+			for _, wb := range b {
+				if wa.op.Return >= wb.op.Call {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	for i := range reads {
+		for j := 0; j < i; j++ {
+			if reads[j].Client != reads[i].Client || sources[i] == nil || sources[j] == nil || states[i] == states[j] {
+				continue
+			}
+			if older(sources[i], sources[j]) {
+				violation := []Operation{reads[j], reads[i]}
+				for _, w := range append(sources[j], sources[i]...) {
+					if w.op.Args != nil {
+						violation = append(violation, w.op)
+					}
+				}
+				return violation, "a client read an older state than it had read before"
+			}
+		}
+	}
+	return nil, ""
+}
+
+// CheckReplicaReads checks the reads of the replicas against an asynchronous replication of the
+// operations of the master, from keys which are missing at the beginning: a read returns a state
+// the master had before the read returned, and a client never reads a state older than the one it
+// read before. The operations of the first violation, with the writes which may have left the key
+// in the states read, are returned with the reason, or nil.
+func CheckReplicaReads(ops []Operation) ([]Operation, string) {
+	master := make(map[string][]Operation)
+	reads := make(map[string][]Operation)
+	var keys []string
+	for _, op := range ops {
+		key := op.Args[1]
+		if _, ok := reads[key]; !ok && op.Replica {
+			keys = append(keys, key)
+		}
+		if op.Replica {
+			reads[key] = append(reads[key], op)
+		} else {
+			master[key] = append(master[key], op)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		// the reads of a client are sequential, so they're ordered by their calls
+		sort.SliceStable(reads[key], func(i, j int) bool { return reads[key][i].Call < reads[key][j].Call })
+		if violation, reason := checkKeyReplicaReads(master[key], reads[key]); violation != nil {
+			return violation, reason
+		}
+	}
+	return nil, ""
+}
+
+// RequireReplicaReads fails the test with the operations of a violation of CheckReplicaReads.
+func RequireReplicaReads(t testing.TB, ops []Operation) {
+	violation, reason := CheckReplicaReads(ops)
+	if violation == nil {
+		return
+	}
+	sort.Slice(violation, func(i, j int) bool { return violation[i].Call < violation[j].Call })
+	var sb strings.Builder
+	for _, op := range violation {
+		sb.WriteString("  " + op.String() + "\n")
+	}
+	require.Failf(t, "replica reads are inconsistent", "%s on %s:\n%s", reason, violation[0].Args[1], sb.String())
+}
+
+// RegisterWorkload runs random GET, SET, CAS, CAD and INCR commands on a few keys
+// from concurrent clients, with values drawn from a small set so that CAS and CAD
+// often succeed.
+type RegisterWorkload struct {
+	Keys []string
+	// Clients is the number of concurrent clients.
+	Clients int
+	// Commands is the number of commands run by every client.
+	Commands int
+	// Replicas are read concurrently by ReplicaClients clients each, which run Commands GETs.
+	// The keys are expected to be missing on them at the beginning.
+	Replicas       []*KvrocksServer
+	ReplicaClients int
+}
+
+// Run runs the workload against the server and returns the history, the keys are deleted
+// first. A client stops after its first lost reply.
+func (w RegisterWorkload) Run(t testing.TB, srv *KvrocksServer) *History {
+	c := srv.NewTCPClient()
+	require.NoError(t, c.WriteArgs(append([]string{"DEL"}, w.Keys...)...))
+	r, err := c.ReadReply()
+	require.NoError(t, err)
+	require.Equal(t, ReplyInteger, r.Type, "failed to delete keys: %s", r)
+	require.NoError(t, c.Close())
+
+	h := NewHistory()
+	var wg sync.WaitGroup
+	for i := 0; i < w.Clients; i++ {
+		c := srv.NewTCPClient()
+		wg.Add(1)
+		go func(client int) {
+			defer wg.Done()
+			defer func() { _ = c.Close() }()
+			for j := 0; j < w.Commands; j++ {
+				if _, err := h.Do(client, c, w.command()...); err != nil {
+					return
+				}
+			}
+		}(i)
+	}
+	for i, replica := range w.Replicas {
+		for j := 0; j < w.ReplicaClients; j++ {
+			c := replica.NewTCPClient()
+			wg.Add(1)
+			go func(client int) {
+				defer wg.Done()
+				defer func() { _ = c.Close() }()
+				for k := 0; k < w.Commands; k++ {
+					key := w.Keys[rand.Intn(len(w.Keys))]
+					if _, err := h.DoReplica(client, c, "GET", key); err != nil {
+						return
+					}
+				}
+			}(w.Clients + i*w.ReplicaClients + j)
+		}
+	}
+	wg.Wait()
+	return h
+}
+
+func (w RegisterWorkload) command() []string {
+	key := w.Keys[rand.Intn(len(w.Keys))]
+	value := func() string { return strconv.Itoa(rand.Intn(5)) }
+	return RandPath(
+		func() []string { return []string{"GET", key} },
+		func() []string { return []string{"SET", key, value()} },
+		func() []string { return []string{"CAS", key, value(), value()} },
+		func() []string { return []string{"CAD", key, value()} },
+		func() []string { return []string{"INCR", key} },
+	)
+}
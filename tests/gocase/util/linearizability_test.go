@@ -0,0 +1,232 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package util
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// op returns an operation of the client called and returned at the times in milliseconds.
+func op(client int, call, ret time.Duration, reply Reply, args ...string) Operation {
+	return Operation{Client: client, Args: args, Reply: reply, Call: call * time.Millisecond, Return: ret * time.Millisecond}
+}
+
+func lost(client int, call time.Duration, args ...string) Operation {
+	return Operation{Client: client, Args: args, Call: call * time.Millisecond, Return: math.MaxInt64, Lost: true}
+}
+
+func replica(o Operation) Operation {
+	o.Replica = true
+	return o
+}
+
+func TestCheckKeyLinearizable(t *testing.T) {
+	ok := SimpleStringReply("OK")
+	for _, c := range []struct {
+		name         string
+		ops          []Operation
+		linearizable bool
+	}{
+		{
+			name: "sequential operations",
+			ops: []Operation{
+				op(0, 0, 1, NilBulkStringReply(), "GET", "k"),
+				op(0, 2, 3, ok, "SET", "k", "1"),
+				op(1, 4, 5, IntegerReply(2), "INCR", "k"),
+				op(0, 6, 7, BulkStringReply("2"), "GET", "k"),
+			},
+			linearizable: true,
+		},
+		{
+			name: "a stale read after an acknowledged write",
+			ops: []Operation{
+				op(0, 0, 1, ok, "SET", "k", "1"),
+				op(0, 2, 3, ok, "SET", "k", "2"),
+				op(1, 4, 5, BulkStringReply("1"), "GET", "k"),
+			},
+		},
+		{
+			name: "a read of a value never written",
+			ops: []Operation{
+				op(0, 0, 1, ok, "SET", "k", "1"),
+				op(1, 2, 3, BulkStringReply("3"), "GET", "k"),
+			},
+		},
+		{
+			name: "concurrent operations valid in one order",
+			ops: []Operation{
+				op(0, 0, 10, ok, "SET", "k", "1"),
+				op(1, 1, 9, IntegerReply(1), "CAS", "k", "1", "2"),
+				op(2, 11, 12, BulkStringReply("2"), "GET", "k"),
+			},
+			linearizable: true,
+		},
+		{
+			name: "concurrent operations valid in no order",
+			ops: []Operation{
+				op(0, 0, 10, ok, "SET", "k", "1"),
+				op(1, 1, 9, IntegerReply(1), "CAS", "k", "1", "2"),
+				op(2, 11, 12, BulkStringReply("1"), "GET", "k"),
+			},
+		},
+		{
+			name: "a lost operation which took effect later",
+			ops: []Operation{
+				lost(0, 0, "INCR", "k"),
+				op(1, 1, 2, NilBulkStringReply(), "GET", "k"),
+				op(1, 3, 4, BulkStringReply("1"), "GET", "k"),
+			},
+			linearizable: true,
+		},
+		{
+			name: "a lost operation which never took effect",
+			ops: []Operation{
+				lost(0, 0, "SET", "k", "1"),
+				op(1, 1, 2, NilBulkStringReply(), "GET", "k"),
+			},
+			linearizable: true,
+		},
+		{
+			name: "a lost operation which took effect twice",
+			ops: []Operation{
+				lost(0, 0, "INCR", "k"),
+				op(1, 1, 2, BulkStringReply("2"), "GET", "k"),
+			},
+		},
+		{
+			name: "errors are equivalent",
+			ops: []Operation{
+				op(0, 0, 1, ok, "SET", "k", "a"),
+				op(1, 2, 3, ErrorReply("ERR value is not an integer or out of range"), "INCR", "k"),
+			},
+			linearizable: true,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.linearizable, checkKeyLinearizable(c.ops))
+		})
+	}
+}
+
+func TestCheckLinearizable(t *testing.T) {
+	ok := SimpleStringReply("OK")
+	a := []Operation{
+		op(0, 0, 1, ok, "SET", "a", "1"),
+		op(1, 2, 3, BulkStringReply("1"), "GET", "a"),
+	}
+	b := []Operation{
+		op(0, 4, 5, ok, "SET", "b", "1"),
+		op(1, 6, 7, NilBulkStringReply(), "GET", "b"),
+	}
+	// replica reads are left to CheckReplicaReads
+	stale := replica(op(2, 8, 9, BulkStringReply("3"), "GET", "a"))
+
+	require.Nil(t, CheckLinearizable(append(append([]Operation{}, a...), stale)))
+	require.Equal(t, b, CheckLinearizable(append(append([]Operation{}, a...), b...)))
+}
+
+func TestCheckKeyReplicaReads(t *testing.T) {
+	master := []Operation{
+		op(0, 0, 1, SimpleStringReply("OK"), "SET", "k", "1"),
+		op(0, 2, 3, SimpleStringReply("OK"), "SET", "k", "2"),
+		op(0, 10, 11, IntegerReply(1), "CAS", "k", "2", "3"),
+		op(0, 12, 13, IntegerReply(0), "CAS", "k", "2", "4"),
+	}
+	for _, c := range []struct {
+		name   string
+		reads  []Operation
+		reason string
+	}{
+		{
+			name: "reads catching up",
+			reads: []Operation{
+				op(5, 0, 1, NilBulkStringReply(), "GET", "k"),
+				op(5, 4, 5, BulkStringReply("1"), "GET", "k"),
+				op(5, 20, 21, BulkStringReply("3"), "GET", "k"),
+			},
+		},
+		{
+			name: "a read of a value written concurrently",
+			reads: []Operation{
+				op(5, 9, 10, BulkStringReply("3"), "GET", "k"),
+			},
+		},
+		{
+			name: "reads of different clients going backwards",
+			reads: []Operation{
+				op(5, 4, 5, BulkStringReply("2"), "GET", "k"),
+				op(6, 6, 7, BulkStringReply("1"), "GET", "k"),
+			},
+		},
+		{
+			name: "a read of a value never written",
+			reads: []Operation{
+				op(5, 20, 21, BulkStringReply("4"), "GET", "k"),
+			},
+			reason: "the master never had the state read before the read returned",
+		},
+		{
+			name: "a read of a value written after it returned",
+			reads: []Operation{
+				op(5, 4, 5, BulkStringReply("3"), "GET", "k"),
+			},
+			reason: "the master never had the state read before the read returned",
+		},
+		{
+			name: "a replica read going backwards",
+			reads: []Operation{
+				op(5, 4, 5, BulkStringReply("2"), "GET", "k"),
+				op(5, 6, 7, BulkStringReply("1"), "GET", "k"),
+			},
+			reason: "a client read an older state than it had read before",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			violation, reason := checkKeyReplicaReads(master, c.reads)
+			require.Equal(t, c.reason, reason)
+			require.Equal(t, c.reason != "", violation != nil)
+		})
+	}
+}
+
+func TestCheckReplicaReads(t *testing.T) {
+	ops := []Operation{
+		op(0, 0, 1, SimpleStringReply("OK"), "SET", "a", "1"),
+		op(0, 2, 3, SimpleStringReply("OK"), "SET", "b", "1"),
+		op(0, 4, 5, SimpleStringReply("OK"), "SET", "b", "2"),
+		// the reads of a client are ordered by their calls whatever their order in the history
+		replica(op(5, 8, 9, BulkStringReply("1"), "GET", "a")),
+		replica(op(5, 6, 7, NilBulkStringReply(), "GET", "a")),
+	}
+	violation, reason := CheckReplicaReads(ops)
+	require.Nil(t, violation, reason)
+
+	backwards := []Operation{
+		replica(op(5, 6, 7, BulkStringReply("2"), "GET", "b")),
+		replica(op(5, 8, 9, BulkStringReply("1"), "GET", "b")),
+	}
+	violation, reason = CheckReplicaReads(append(ops, backwards...))
+	require.Equal(t, "a client read an older state than it had read before", reason)
+	require.Equal(t, append(backwards, ops[2], ops[1]), violation)
+}
@@ -0,0 +1,289 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type LogLevel int
+
+const (
+	LogInfo LogLevel = iota
+	LogWarning
+	LogError
+	LogFatal
+)
+
+const logLevels = "IWEF"
+
+func (l LogLevel) String() string {
+	return [...]string{"INFO", "WARNING", "ERROR", "FATAL"}[l]
+}
+
+// LogRecord is a line of the server logs, with the following lines which don't start
+// with a glog prefix appended to its message.
+type LogRecord struct {
+	Level   LogLevel
+	Time    time.Time
+	Thread  int
+	File    string
+	Line    int
+	Message string
+}
+
+func (r LogRecord) String() string {
+	return fmt.Sprintf("%c%s %d %s:%d] %s", logLevels[r.Level], r.Time.Format("20060102 15:04:05.000000"),
+		r.Thread, r.File, r.Line, r.Message)
+}
+
+// glog prefixes lines with the level, the date, with the year since glog 0.6, the time,
+// the thread ID and the source location.
+var logLinePattern = regexp.MustCompile(`^([IWEF])(\d{8}|\d{4}) (\d{2}:\d{2}:\d{2}\.\d{6}) +(\d+) ([^ :\]]+):(\d+)\] (.*)$`)
+
+func parseLogLine(line string) (LogRecord, bool) {
+	m := logLinePattern.FindStringSubmatch(line)
+	if m == nil {
+		return LogRecord{}, false
+	}
+	date := m[2]
+	if len(date) == 4 {
+		date = strconv.Itoa(time.Now().Year()) + date
+	}
+	at, err := time.ParseInLocation("20060102 15:04:05.000000", date+" "+m[3], time.Local)
+	if err != nil {
+		return LogRecord{}, false
+	}
+	thread, _ := strconv.Atoi(m[4])
+	lineNo, _ := strconv.Atoi(m[6])
+	return LogRecord{
+		Level:   LogLevel(strings.IndexByte(logLevels, m[1][0])),
+		Time:    at,
+		Thread:  thread,
+		File:    m[5],
+		Line:    lineNo,
+		Message: m[7],
+	}, true
+}
+
+// LogMarker is a position in the server logs.
+type LogMarker int
+
+type tailedLogFile struct {
+	path   string
+	offset int64
+	// partial is the last line read, which isn't terminated yet.
+	partial string
+	// started is set once the first record is read, the lines before it are the file header.
+	started bool
+}
+
+// logTailer follows the log files of a server incrementally. glog writes every record
+// to the INFO file, and also to the WARNING and ERROR files depending on its level, so
+// only the INFO files are followed. A new file is created every time the server starts.
+type logTailer struct {
+	pattern string
+
+	mu      sync.Mutex
+	files   []*tailedLogFile
+	records []LogRecord
+}
+
+// newLogTailer follows the logs of a server with the given configuration, they're written
+// to the stdout file if log-dir is stdout.
+func newLogTailer(configs map[string]string) *logTailer {
+	dir := configs["log-dir"]
+	if strings.ToLower(dir) == "stdout" {
+		return &logTailer{pattern: filepath.Join(configs["dir"], "stdout")}
+	}
+	if dir == "" {
+		dir = configs["dir"]
+	}
+	return &logTailer{pattern: filepath.Join(dir, "kvrocks.*.log.INFO.*")}
+}
+
+// poll reads the lines appended to the log files since the last poll.
+func (l *logTailer) poll() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	paths, err := filepath.Glob(l.pattern)
+	if err != nil {
+		return err
+	}
+	var added []*tailedLogFile
+	for _, path := range paths {
+		known := false
+		for _, f := range l.files {
+			if f.path == path {
+				known = true
+				break
+			}
+		}
+		if !known {
+			added = append(added, &tailedLogFile{path: path})
+		}
+	}
+	// files of the same second differ by the PID, so they're ordered by creation instead of name
+	modTime := func(f *tailedLogFile) time.Time {
+		info, err := os.Stat(f.path)
+		if err != nil {
+			return time.Time{}
+		}
+		return info.ModTime()
+	}
+	sort.SliceStable(added, func(i, j int) bool { return modTime(added[i]).Before(modTime(added[j])) })
+	l.files = append(l.files, added...)
+
+	for _, f := range l.files {
+		if err := l.read(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *logTailer) read(f *tailedLogFile) error {
+	file, err := os.Open(f.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	if _, err := file.Seek(f.offset, io.SeekStart); err != nil {
+		return err
+	}
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	f.offset += int64(len(content))
+
+	end := bytes.LastIndexByte(content, '\n')
+	if end < 0 {
+		f.partial += string(content)
+		return nil
+	}
+	lines := strings.Split(f.partial+string(content[:end]), "\n")
+	f.partial = string(content[end+1:])
+	for _, line := range lines {
+		if record, ok := parseLogLine(line); ok {
+			l.records = append(l.records, record)
+			f.started = true
+		} else if f.started && line != "" {
+			l.records[len(l.records)-1].Message += "\n" + line
+		}
+	}
+	return nil
+}
+
+// LogMarker returns the current end of the server logs, see LogsSince.
+func (s *KvrocksServer) LogMarker() LogMarker {
+	require.NoError(s.t, s.logs.poll())
+	s.logs.mu.Lock()
+	defer s.logs.mu.Unlock()
+	return LogMarker(len(s.logs.records))
+}
+
+// LogsSince returns the records logged by the server since the marker, including
+// those logged before restarts.
+func (s *KvrocksServer) LogsSince(marker LogMarker) []LogRecord {
+	require.NoError(s.t, s.logs.poll())
+	s.logs.mu.Lock()
+	defer s.logs.mu.Unlock()
+	return append([]LogRecord(nil), s.logs.records[marker:]...)
+}
+
+// WaitForLog waits for a record of the given level or above whose message matches the pattern,
+// and returns it. Records logged since the server was last started or restarted are matched,
+// use LogMarker and LogsSince to only match those logged after some point.
+func (s *KvrocksServer) WaitForLog(t testing.TB, level LogLevel, pattern string, timeout time.Duration) LogRecord {
+	p := regexp.MustCompile(pattern)
+	deadline := time.Now().Add(timeout)
+	marker := s.startMarker
+	for {
+		record, next, ok := s.findLog(level, p, marker)
+		if ok {
+			return record
+		}
+		marker = next
+		if time.Now().After(deadline) {
+			require.Failf(t, "log not found", "no %s log matching %q within %v, the last lines are:\n%s",
+				level, pattern, timeout, s.formatLastLogs(*logTailLines))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// LogFileMatches reports whether a record logged since the server was last started or restarted
+// matches the pattern, like WaitForLog without waiting.
+func (s *KvrocksServer) LogFileMatches(t testing.TB, pattern string) bool {
+	_, _, ok := s.findLog(LogInfo, regexp.MustCompile(pattern), s.startMarker)
+	return ok
+}
+
+// findLog returns the first record since the marker of the given level or above whose message
+// matches the pattern, and the marker past the records it went through.
+func (s *KvrocksServer) findLog(level LogLevel, p *regexp.Regexp, marker LogMarker) (LogRecord, LogMarker, bool) {
+	for _, record := range s.LogsSince(marker) {
+		marker++
+		if record.Level >= level && p.MatchString(record.Message) {
+			return record, marker, true
+		}
+	}
+	return LogRecord{}, marker, false
+}
+
+func (s *KvrocksServer) formatLastLogs(n int) string {
+	if err := s.logs.poll(); err != nil {
+		return fmt.Sprintf("failed to read logs: %v", err)
+	}
+	s.logs.mu.Lock()
+	defer s.logs.mu.Unlock()
+	records := s.logs.records
+	if len(records) > n {
+		records = records[len(records)-n:]
+	}
+	var sb strings.Builder
+	for _, record := range records {
+		sb.WriteString(record.String() + "\n")
+	}
+	return sb.String()
+}
+
+// dumpLogs logs the last lines of the server logs to the test log, it's called when the server
+// is closed after the test has failed.
+func (s *KvrocksServer) dumpLogs() {
+	s.t.Logf("the last %d log lines of the server at %s are:\n%s", *logTailLines, s.HostPort(), s.formatLastLogs(*logTailLines))
+}
@@ -0,0 +1,330 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package util
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slices"
+)
+
+// Model is the reference implementation of a data type in model-based test cases.
+type Model interface {
+	// Apply runs the command on the model and returns the reply expected from the server.
+	Apply(args []string) Reply
+	// StateQueries returns read-only commands whose replies cover the whole state
+	// of the model, they are compared after every step.
+	StateQueries() [][]string
+}
+
+// NondeterministicModel is a model of a data type with commands whose replies are not
+// determined by the state, like SPOP.
+type NondeterministicModel interface {
+	Model
+	// Observe checks the actual reply if the command is nondeterministic, and updates the model
+	// with it. It returns the actual reply if it's valid, or another one describing the violation.
+	Observe(args []string, actual Reply) (Reply, bool)
+}
+
+// ModelTest runs the same random commands on a server and a fresh model, and compares every
+// reply to the one of the model. A failing sequence is shrunk to a minimal reproducer by
+// replaying subsequences of it on empty keys.
+type ModelTest struct {
+	// NewModel returns an empty model.
+	NewModel func() Model
+	// Command returns a random command, it may look into the model to pick meaningful arguments.
+	Command func(m Model) []string
+	// Keys are all keys touched by the commands, they are deleted before every run.
+	Keys []string
+	// Normalizers are applied to both the expected and the actual replies before comparing them.
+	Normalizers []Normalizer
+	// Steps is the number of commands of a run.
+	Steps int
+}
+
+// Run runs the model test against the server, the random sequence is determined by math/rand,
+// see SeedRandom to make it replayable.
+func (mt ModelTest) Run(t testing.TB, srv *KvrocksServer) {
+	c := srv.NewTCPClient()
+	defer func() { require.NoError(t, c.Close()) }()
+
+	mt.reset(t, c)
+	m := mt.NewModel()
+	var history [][]string
+	for i := 0; i < mt.Steps; i++ {
+		args := mt.Command(m)
+		history = append(history, args)
+		if mismatch := mt.step(t, c, m, args); mismatch != "" {
+			reproducer := ShrinkCommands(history, func(cmds [][]string) bool {
+				_, mismatch := mt.replay(t, c, cmds)
+				return mismatch != ""
+			})
+			_, mismatch = mt.replay(t, c, reproducer)
+			var sb strings.Builder
+			for _, cmd := range reproducer {
+				sb.WriteString("  " + formatArgs(cmd) + "\n")
+			}
+			require.Failf(t, "server diverges from the model",
+				"%s\nafter step %d, minimal reproducer on empty keys:\n%s", mismatch, i, sb.String())
+		}
+	}
+}
+
+func (mt ModelTest) reset(t testing.TB, c *TCPClient) {
+	require.NoError(t, c.WriteArgs(append([]string{"DEL"}, mt.Keys...)...))
+	r, err := c.ReadReply()
+	require.NoError(t, err)
+	require.Equal(t, ReplyInteger, r.Type, "failed to delete keys: %s", r)
+}
+
+// replay runs the commands on empty keys and returns the index of the first mismatching step, or -1.
+func (mt ModelTest) replay(t testing.TB, c *TCPClient, cmds [][]string) (int, string) {
+	mt.reset(t, c)
+	m := mt.NewModel()
+	for i, args := range cmds {
+		if mismatch := mt.step(t, c, m, args); mismatch != "" {
+			return i, mismatch
+		}
+	}
+	return -1, ""
+}
+
+// step runs the command and then the state queries, and describes the first mismatch if any.
+func (mt ModelTest) step(t testing.TB, c *TCPClient, m Model, args []string) string {
+	if mismatch := mt.compare(t, c, m, args); mismatch != "" {
+		return mismatch
+	}
+	for _, query := range m.StateQueries() {
+		if mismatch := mt.compare(t, c, m, query); mismatch != "" {
+			return "state check failed, " + mismatch
+		}
+	}
+	return ""
+}
+
+func (mt ModelTest) compare(t testing.TB, c *TCPClient, m Model, args []string) string {
+	require.NoError(t, c.WriteArgs(args...))
+	actual, err := c.ReadReply()
+	require.NoError(t, err)
+	var expected Reply
+	observed := false
+	if nm, ok := m.(NondeterministicModel); ok {
+		expected, observed = nm.Observe(args, actual)
+	}
+	if !observed {
+		expected = m.Apply(args)
+	}
+	for _, n := range mt.Normalizers {
+		expected, actual = n(args, expected), n(args, actual)
+	}
+	if reflect.DeepEqual(expected, actual) {
+		return ""
+	}
+	return fmt.Sprintf("command: %s\nexpected:\n%s\nactual:\n%s", formatArgs(args), expected, actual)
+}
+
+// GeneratingModel is a model which generates its own random commands.
+type GeneratingModel interface {
+	Model
+	// Command returns a random command, it may look into the model to pick meaningful arguments.
+	Command() []string
+}
+
+// RunModel runs a model test of 2000 steps against a fresh server, with the random sequence
+// seeded by SeedRandom. The models returned by newModel must be GeneratingModels, errors and
+// the remaining time to live are normalized before the normalizers given.
+func RunModel(t *testing.T, newModel func() Model, keys []string, normalizers ...Normalizer) {
+	SeedRandom(t)
+	srv := StartServer(t, map[string]string{})
+	defer srv.Close()
+
+	ModelTest{
+		NewModel:    newModel,
+		Command:     func(m Model) []string { return m.(GeneratingModel).Command() },
+		Keys:        keys,
+		Normalizers: append([]Normalizer{NormalizeErrors, NormalizeTTL}, normalizers...),
+		Steps:       2000,
+	}.Run(t, srv)
+}
+
+// Quirk is a known divergence of kvrocks from Redis. Models follow Redis, so the commands which
+// run into a quirk aren't generated, and RunQuirkChecks tells whether it's still there.
+type Quirk[M any] struct {
+	Name string
+	// Applies reports whether the command run on the model runs into the quirk.
+	Applies func(m M, args []string) bool
+	// Check runs commands which show the quirk, it reports whether it's still there, and
+	// requires the replies of Redis otherwise.
+	Check func(t *testing.T, do func(args ...string) Reply) bool
+}
+
+// AvoidQuirks returns the first command of the generator which doesn't run into any of the quirks.
+func AvoidQuirks[M any](m M, quirks []Quirk[M], generate func() []string) []string {
+	for {
+		args := generate()
+		if slices.IndexFunc(quirks, func(q Quirk[M]) bool { return q.Applies(m, args) }) < 0 {
+			return args
+		}
+	}
+}
+
+// RunQuirkChecks checks the quirks against a fresh server. A quirk which is still there skips its
+// case, which fails once it's fixed, so that it's removed from the list and the model covers it.
+func RunQuirkChecks[M any](t *testing.T, quirks []Quirk[M]) {
+	srv := StartServer(t, map[string]string{})
+	defer srv.Close()
+	c := srv.NewTCPClient()
+	defer func() { require.NoError(t, c.Close()) }()
+
+	for _, q := range quirks {
+		t.Run(q.Name, func(t *testing.T) {
+			do := func(args ...string) Reply {
+				require.NoError(t, c.WriteArgs(args...))
+				r, err := c.ReadReply()
+				require.NoError(t, err)
+				return r
+			}
+			if q.Check(t, do) {
+				t.Skipf("known divergence from Redis: %s", q.Name)
+			}
+			require.Fail(t, "the quirk is fixed, it should be removed from the known quirks")
+		})
+	}
+}
+
+// ShrinkCommands removes chunks of commands of decreasing sizes from the sequence
+// as long as the shorter sequence still fails.
+func ShrinkCommands(cmds [][]string, fails func(cmds [][]string) bool) [][]string {
+	for chunk := len(cmds) / 2; chunk >= 1; chunk /= 2 {
+		for start := 0; start < len(cmds); {
+			end := start + chunk
+			if end > len(cmds) {
+				end = len(cmds)
+			}
+			candidate := append(slices.Clone(cmds[:start]), cmds[end:]...)
+			if len(candidate) > 0 && fails(candidate) {
+				cmds = candidate
+			} else {
+				start = end
+			}
+		}
+	}
+	return cmds
+}
+
+// NormalizeTTL replaces any remaining time to live replied by TTL or PTTL by 1,
+// so that models only have to tell whether a key has an expiration.
+func NormalizeTTL(args []string, r Reply) Reply {
+	if (strings.EqualFold(args[0], "ttl") || strings.EqualFold(args[0], "pttl")) && r.Type == ReplyInteger && r.Int > 0 {
+		return IntegerReply(1)
+	}
+	return r
+}
+
+// ModelKeyspace implements the generic key commands DEL, EXISTS, EXPIRE, TTL and TYPE for
+// models of a single data type, the content of the keys is kept by the model itself.
+type ModelKeyspace struct {
+	// Type is the reply of TYPE for an existing key.
+	Type string
+	// Exists reports whether the model has the key.
+	Exists func(key string) bool
+	// Delete removes the key from the model.
+	Delete func(key string)
+
+	expiring map[string]bool
+}
+
+// Apply runs the command if it's a generic key command, the expiration set by EXPIRE
+// is either far in the future or in the past, so that keys never expire during a test.
+func (ks *ModelKeyspace) Apply(args []string) (Reply, bool) {
+	if ks.expiring == nil {
+		ks.expiring = make(map[string]bool)
+	}
+	switch strings.ToUpper(args[0]) {
+	case "DEL", "EXISTS":
+		n := 0
+		for _, key := range args[1:] {
+			if ks.Exists(key) {
+				n++
+				if strings.EqualFold(args[0], "del") {
+					ks.Remove(key)
+				}
+			}
+		}
+		return IntegerReply(int64(n)), true
+	case "EXPIRE":
+		key := args[1]
+		seconds, err := strconv.Atoi(args[2])
+		if err != nil {
+			return ErrorReply("ERR value is not an integer or out of range"), true
+		}
+		if !ks.Exists(key) {
+			return IntegerReply(0), true
+		}
+		if seconds < 0 {
+			ks.Remove(key)
+		} else {
+			ks.expiring[key] = true
+		}
+		return IntegerReply(1), true
+	case "TTL":
+		key := args[1]
+		if !ks.Exists(key) {
+			return IntegerReply(-2), true
+		}
+		if ks.expiring[key] {
+			return IntegerReply(1), true
+		}
+		return IntegerReply(-1), true
+	case "TYPE":
+		if ks.Exists(args[1]) {
+			return BulkStringReply(ks.Type), true
+		}
+		return BulkStringReply("none"), true
+	}
+	return Reply{}, false
+}
+
+// Command returns a random generic key command on the key. A negative expiration deletes
+// the key, and a positive one never expires during a test.
+func (ks *ModelKeyspace) Command(key string) []string {
+	if RandomBool() {
+		seconds := "1000"
+		if rand.Intn(4) == 0 {
+			seconds = "-1"
+		}
+		return []string{"EXPIRE", key, seconds}
+	}
+	cmds := []string{"TTL", "TYPE", "EXISTS", "DEL"}
+	return []string{cmds[rand.Intn(len(cmds))], key}
+}
+
+// Remove deletes the key and forgets its expiration, models must call it when
+// a key disappears since the last element is removed.
+func (ks *ModelKeyspace) Remove(key string) {
+	ks.Delete(key)
+	delete(ks.expiring, key)
+}
@@ -0,0 +1,130 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package util
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/go-redis/redis/v9"
+)
+
+type link struct {
+	from *KvrocksServer
+	to   *KvrocksServer
+}
+
+// Network routes the connections between servers through a FaultProxy per
+// directed link, so that any set of links can be cut and healed at runtime.
+// The clients of the test itself are never affected.
+type Network struct {
+	t testing.TB
+
+	mu          sync.Mutex
+	links       map[link]*FaultProxy
+	partitioned map[link]bool
+}
+
+func NewNetwork(t testing.TB) *Network {
+	return &Network{
+		t:           t,
+		links:       make(map[link]*FaultProxy),
+		partitioned: make(map[link]bool),
+	}
+}
+
+// Link returns the proxy used by the server from to connect to the server to.
+func (n *Network) Link(from, to *KvrocksServer) *FaultProxy {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	l := link{from: from, to: to}
+	p, ok := n.links[l]
+	if !ok {
+		p = StartFaultProxy(n.t, to.HostPort())
+		n.links[l] = p
+		if n.partitioned[l] {
+			p.Pause(Upstream, true)
+			p.Pause(Downstream, true)
+		}
+	}
+	return p
+}
+
+// SlaveOf makes the slave replicate from the master through the link between them.
+func (n *Network) SlaveOf(slave *KvrocksServer, slaveClient *redis.Client, master *KvrocksServer) {
+	SlaveOf(n.t, slaveClient, n.Link(slave, master))
+}
+
+// Partition cuts all links between the two groups in both directions. The traffic is held
+// instead of discarded, so that the connections look like TCP connections over a broken network.
+func (n *Network) Partition(groupA, groupB []*KvrocksServer) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, a := range groupA {
+		for _, b := range groupB {
+			n.partitioned[link{from: a, to: b}] = true
+			n.partitioned[link{from: b, to: a}] = true
+		}
+	}
+	n.applyPartitions()
+}
+
+// Isolate partitions the server from all other servers in others.
+func (n *Network) Isolate(srv *KvrocksServer, others []*KvrocksServer) {
+	var rest []*KvrocksServer
+	for _, o := range others {
+		if o != srv {
+			rest = append(rest, o)
+		}
+	}
+	n.Partition([]*KvrocksServer{srv}, rest)
+}
+
+// Heal restores all links cut by Partition.
+func (n *Network) Heal() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.partitioned = make(map[link]bool)
+	n.applyPartitions()
+}
+
+// IsPartitioned reports whether the link from a to b is cut.
+func (n *Network) IsPartitioned(a, b *KvrocksServer) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.partitioned[link{from: a, to: b}]
+}
+
+func (n *Network) applyPartitions() {
+	for l, p := range n.links {
+		cut := n.partitioned[l]
+		p.Pause(Upstream, cut)
+		p.Pause(Downstream, cut)
+	}
+}
+
+func (n *Network) Close() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, p := range n.links {
+		p.Close()
+	}
+	n.links = make(map[link]*FaultProxy)
+}
@@ -0,0 +1,342 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package util
+
+import (
+	"math/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+// Direction is the direction of the traffic passing through a FaultProxy.
+type Direction int
+
+const (
+	// Upstream is the traffic from the client to the target.
+	Upstream Direction = iota
+	// Downstream is the traffic from the target to the client.
+	Downstream
+)
+
+type linkFaults struct {
+	latency   time.Duration
+	jitter    time.Duration
+	bandwidth int
+	blackhole bool
+	paused    bool
+	truncate  int64
+}
+
+// FaultProxy is a TCP proxy in front of a server which can degrade the traffic
+// passing through it at runtime.
+type FaultProxy struct {
+	t      testing.TB
+	lis    *net.TCPListener
+	target string
+
+	mu     sync.Mutex
+	faults [2]linkFaults
+	conns  map[*proxyConn]struct{}
+	closed bool
+
+	wg sync.WaitGroup
+}
+
+type proxyConn struct {
+	client net.Conn
+	server net.Conn
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (c *proxyConn) close(reset bool) {
+	c.once.Do(func() {
+		close(c.closed)
+		for _, conn := range []net.Conn{c.client, c.server} {
+			if tcp, ok := conn.(*net.TCPConn); ok && reset {
+				_ = tcp.SetLinger(0)
+			}
+			_ = conn.Close()
+		}
+	})
+}
+
+// StartFaultProxy starts a proxy listening on a free port which forwards connections to target.
+func StartFaultProxy(t testing.TB, target string) *FaultProxy {
+	addr, err := findFreePort()
+	require.NoError(t, err)
+	lis, err := net.ListenTCP("tcp", addr)
+	require.NoError(t, err)
+
+	p := &FaultProxy{
+		t:      t,
+		lis:    lis,
+		target: target,
+		conns:  make(map[*proxyConn]struct{}),
+	}
+	p.faults[Upstream].truncate = -1
+	p.faults[Downstream].truncate = -1
+
+	p.wg.Add(1)
+	go p.serve()
+	return p
+}
+
+func (p *FaultProxy) HostPort() string {
+	return p.lis.Addr().(*net.TCPAddr).AddrPort().String()
+}
+
+func (p *FaultProxy) Host() string {
+	return p.lis.Addr().(*net.TCPAddr).AddrPort().Addr().String()
+}
+
+func (p *FaultProxy) Port() uint64 {
+	return uint64(p.lis.Addr().(*net.TCPAddr).AddrPort().Port())
+}
+
+func (p *FaultProxy) NewClient() *redis.Client {
+	return redis.NewClient(&redis.Options{Addr: p.HostPort()})
+}
+
+// SetLatency delays every chunk of data in the direction by latency plus a random jitter in [0, jitter).
+func (p *FaultProxy) SetLatency(dir Direction, latency, jitter time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.faults[dir].latency = latency
+	p.faults[dir].jitter = jitter
+}
+
+// SetBandwidth limits the throughput in the direction to bytesPerSecond, 0 means unlimited.
+func (p *FaultProxy) SetBandwidth(dir Direction, bytesPerSecond int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.faults[dir].bandwidth = bytesPerSecond
+}
+
+// Blackhole silently discards the data in the direction while the connections are kept open.
+func (p *FaultProxy) Blackhole(dir Direction, enabled bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.faults[dir].blackhole = enabled
+}
+
+// Pause holds the data in the direction until it's resumed, like a link which is down
+// while TCP keeps retransmitting. The data is delivered in order after resuming.
+func (p *FaultProxy) Pause(dir Direction, paused bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.faults[dir].paused = paused
+}
+
+// TruncateAfter closes every connection once n bytes have been forwarded in the direction
+// over it, a negative n disables the truncation.
+func (p *FaultProxy) TruncateAfter(dir Direction, n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.faults[dir].truncate = n
+}
+
+// Heal removes all faults, the established connections are kept.
+func (p *FaultProxy) Heal() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.faults = [2]linkFaults{{truncate: -1}, {truncate: -1}}
+}
+
+// ResetConnections aborts all established connections with a TCP RST.
+func (p *FaultProxy) ResetConnections() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for c := range p.conns {
+		c.close(true)
+	}
+}
+
+func (p *FaultProxy) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	require.NoError(p.t, p.lis.Close())
+	p.ResetConnections()
+	p.wg.Wait()
+}
+
+func (p *FaultProxy) linkFaults(dir Direction) linkFaults {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.faults[dir]
+}
+
+func (p *FaultProxy) serve() {
+	defer p.wg.Done()
+	for {
+		client, err := p.lis.Accept()
+		if err != nil {
+			return
+		}
+		server, err := net.Dial("tcp", p.target)
+		if err != nil {
+			_ = client.Close()
+			continue
+		}
+
+		c := &proxyConn{client: client, server: server, closed: make(chan struct{})}
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			c.close(true)
+			return
+		}
+		p.conns[c] = struct{}{}
+		p.mu.Unlock()
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		p.wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.forward(c, client, server, Upstream)
+		}()
+		go func() {
+			defer wg.Done()
+			p.forward(c, server, client, Downstream)
+		}()
+		go func() {
+			defer p.wg.Done()
+			wg.Wait()
+			p.mu.Lock()
+			delete(p.conns, c)
+			p.mu.Unlock()
+		}()
+	}
+}
+
+type proxyChunk struct {
+	data      []byte
+	deliverAt time.Time
+}
+
+// forward copies data from src to dst, the reader applies the latency and blackhole
+// when a chunk arrives while the writer applies the pause, the bandwidth limit and the truncation.
+func (p *FaultProxy) forward(c *proxyConn, src, dst net.Conn, dir Direction) {
+	chunks := make(chan proxyChunk, 1024)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		var written int64
+		for chunk := range chunks {
+			if d := time.Until(chunk.deliverAt); d > 0 {
+				time.Sleep(d)
+			}
+			f := p.linkFaults(dir)
+			for f.paused {
+				select {
+				case <-c.closed:
+					return
+				case <-time.After(10 * time.Millisecond):
+				}
+				f = p.linkFaults(dir)
+			}
+			data := chunk.data
+			truncated := false
+			if f.truncate >= 0 && written+int64(len(data)) >= f.truncate {
+				if remain := f.truncate - written; remain > 0 {
+					data = data[:remain]
+				} else {
+					data = nil
+				}
+				truncated = true
+			}
+			if err := writeThrottled(dst, data, f.bandwidth); err != nil {
+				c.close(false)
+				return
+			}
+			written += int64(len(data))
+			if truncated {
+				c.close(false)
+				return
+			}
+		}
+	}()
+
+	var last time.Time
+	buf := make([]byte, 16*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			f := p.linkFaults(dir)
+			if !f.blackhole {
+				deliverAt := time.Now().Add(f.latency)
+				if f.jitter > 0 {
+					deliverAt = deliverAt.Add(time.Duration(rand.Int63n(int64(f.jitter))))
+				}
+				// keep the order of the stream even if the jitter is larger than the interval of chunks
+				if deliverAt.Before(last) {
+					deliverAt = last
+				}
+				last = deliverAt
+				data := make([]byte, n)
+				copy(data, buf[:n])
+				select {
+				case chunks <- proxyChunk{data: data, deliverAt: deliverAt}:
+				case <-done:
+				}
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	// deliver the pending data before closing the other side
+	close(chunks)
+	<-done
+	c.close(false)
+}
+
+// writeThrottled writes data in pieces of 10ms worth of bandwidth, 0 means unlimited.
+func writeThrottled(w net.Conn, data []byte, bandwidth int) error {
+	if bandwidth <= 0 {
+		_, err := w.Write(data)
+		return err
+	}
+	piece := bandwidth / 100
+	if piece == 0 {
+		piece = 1
+	}
+	for len(data) > 0 {
+		n := piece
+		if n > len(data) {
+			n = len(data)
+		}
+		time.Sleep(time.Duration(n) * time.Second / time.Duration(bandwidth))
+		if _, err := w.Write(data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
@@ -23,13 +23,32 @@ import (
 	"fmt"
 	"math/rand"
 	"strings"
+	"testing"
+	"time"
 )
 
+// SeedRandom seeds math/rand with the seed given by `-randSeed` or a random one,
+// and logs it so that a failed randomized case can be replayed.
+func SeedRandom(t testing.TB) int64 {
+	seed := *randSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rand.Seed(seed)
+	t.Logf("random seed: %d, replay with -randSeed=%d", seed, seed)
+	return seed
+}
+
 func RandPath[T any](f ...func() T) T {
 	index := rand.Int31n(int32(len(f)))
 	return f[index]()
 }
 
+// OneOf returns one of the strings at random, a string given several times is more likely.
+func OneOf(ss ...string) string {
+	return ss[rand.Intn(len(ss))]
+}
+
 func RandPathNoResult(f ...func()) {
 	index := rand.Int31n(int32(len(f)))
 	f[index]()
@@ -0,0 +1,124 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+// RedisServer is a stock redis-server used as the reference of differential test cases.
+type RedisServer struct {
+	t    testing.TB
+	cmd  *exec.Cmd
+	addr *net.TCPAddr
+
+	clean func()
+}
+
+// StartRedisServer starts the redis-server given by `-redisServerPath` without persistence,
+// the test is skipped if the path is not set.
+func StartRedisServer(t testing.TB) *RedisServer {
+	b := *redisServerPath
+	if b == "" {
+		t.Skip("please set the path of redis-server by `-redisServerPath` to run differential test cases")
+	}
+
+	addr, err := findFreePort()
+	require.NoError(t, err)
+
+	dir := *workspace
+	require.NotEmpty(t, dir, "please set the workspace by `-workspace`")
+	dir, err = os.MkdirTemp(dir, fmt.Sprintf("%s-redis-%d-*", t.Name(), time.Now().UnixMilli()))
+	require.NoError(t, err)
+
+	cmd := exec.Command(b,
+		"--bind", addr.IP.String(),
+		"--port", fmt.Sprintf("%d", addr.Port),
+		"--dir", dir,
+		"--save", "",
+		"--appendonly", "no",
+	)
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	require.NoError(t, err)
+	cmd.Stdout = stdout
+	stderr, err := os.Create(filepath.Join(dir, "stderr"))
+	require.NoError(t, err)
+	cmd.Stderr = stderr
+
+	require.NoError(t, cmd.Start())
+
+	c := redis.NewClient(&redis.Options{Addr: addr.String()})
+	defer func() { require.NoError(t, c.Close()) }()
+	require.Eventually(t, func() bool {
+		return c.Ping(context.Background()).Err() == nil
+	}, time.Minute, 100*time.Millisecond)
+
+	return &RedisServer{
+		t:    t,
+		cmd:  cmd,
+		addr: addr,
+		clean: func() {
+			require.NoError(t, stdout.Close())
+			require.NoError(t, stderr.Close())
+			if !t.Failed() || *deleteOnExit {
+				require.NoError(t, os.RemoveAll(dir))
+			}
+		},
+	}
+}
+
+func (s *RedisServer) HostPort() string {
+	return s.addr.AddrPort().String()
+}
+
+func (s *RedisServer) Host() string {
+	return s.addr.AddrPort().Addr().String()
+}
+
+func (s *RedisServer) Port() uint64 {
+	return uint64(s.addr.AddrPort().Port())
+}
+
+func (s *RedisServer) NewClient() *redis.Client {
+	return redis.NewClient(&redis.Options{Addr: s.addr.String()})
+}
+
+func (s *RedisServer) NewTCPClient() *TCPClient {
+	c, err := net.Dial(s.addr.Network(), s.addr.String())
+	require.NoError(s.t, err)
+	return newTCPClient(c)
+}
+
+func (s *RedisServer) Close() {
+	require.NoError(s.t, s.cmd.Process.Signal(syscall.SIGTERM))
+	require.NoError(s.t, s.cmd.Wait())
+	s.clean()
+}
@@ -0,0 +1,313 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package util
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slices"
+)
+
+// ResourceSample is the resource usage of the server process at some time.
+type ResourceSample struct {
+	Time time.Time
+	PID  int32
+	RSS  uint64
+	// CPU is the CPU usage since the previous sample of the same process, 100 is a whole core.
+	CPU     float64
+	FDs     int32
+	Threads int32
+	// DiskUsage is the total size of the files in the server directory.
+	DiskUsage int64
+}
+
+// ResourceMonitor samples the resource usage of the server process in the background,
+// across restarts.
+type ResourceMonitor struct {
+	dir      string
+	interval time.Duration
+
+	mu      sync.Mutex
+	proc    *process.Process
+	samples []ResourceSample
+	// baselineAt is the time of the sample taken by the last ResetBaseline.
+	baselineAt time.Time
+
+	// procMu serializes the samples of the process, whose CPU usage is measured since the previous one.
+	procMu sync.Mutex
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// MonitorResources starts sampling the resource usage of the server at the interval. The monitor
+// is stopped and its summary is logged when the server is closed. The first sample after it's
+// started, after ResetBaseline, or after the server restarts, is the baseline of RequireNoFDLeak.
+// If the resources are already monitored, e.g. with -resourceSampleInterval, the running monitor
+// is returned as is.
+func (s *KvrocksServer) MonitorResources(interval time.Duration) *ResourceMonitor {
+	if s.monitor != nil {
+		return s.monitor
+	}
+	m := &ResourceMonitor{
+		dir:      s.configs["dir"],
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	m.setProcess(s.t, s.cmd.Process.Pid)
+	s.monitor = m
+	go m.run()
+	return m
+}
+
+// WaitForStableFDs waits for the number of open file descriptors of the server to stay the same
+// for the duration, e.g. until the connections closed before are released, so that the baseline
+// of MonitorResources or ResetBaseline is stable.
+func (s *KvrocksServer) WaitForStableFDs(t testing.TB, duration time.Duration) {
+	proc, err := process.NewProcess(int32(s.cmd.Process.Pid))
+	require.NoError(t, err)
+	last, since := int32(-1), time.Now()
+	require.Eventually(t, func() bool {
+		n, err := proc.NumFDs()
+		if err != nil || n != last {
+			last, since = n, time.Now()
+		}
+		return time.Since(since) >= duration
+	}, 10*time.Second+duration, 100*time.Millisecond, "the number of open file descriptors doesn't settle")
+}
+
+// setProcess makes the monitor follow the process, it's called when the server restarts.
+func (m *ResourceMonitor) setProcess(t testing.TB, pid int) {
+	proc, err := process.NewProcess(int32(pid))
+	require.NoError(t, err)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.proc = proc
+}
+
+func (m *ResourceMonitor) run() {
+	defer close(m.done)
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		// samples fail while the server is restarting, they're skipped
+		_, _ = m.sample()
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sample samples the resource usage of the server and records it. The server directory is walked
+// without holding the lock, since it may take a while.
+func (m *ResourceMonitor) sample() (ResourceSample, error) {
+	sample, err := m.sampleProcess()
+	if err != nil {
+		return sample, err
+	}
+	err = filepath.WalkDir(m.dir, func(path string, d fs.DirEntry, err error) error {
+		// files are removed concurrently by the server, e.g. after compactions
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			sample.DiskUsage += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return sample, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// samples taken concurrently are kept in the order of their times
+	i := len(m.samples)
+	for i > 0 && m.samples[i-1].Time.After(sample.Time) {
+		i--
+	}
+	m.samples = slices.Insert(m.samples, i, sample)
+	return sample, nil
+}
+
+// sampleProcess samples the process, the CPU usage is measured since its previous sample. The
+// process is read without holding the lock of the samples.
+func (m *ResourceMonitor) sampleProcess() (ResourceSample, error) {
+	m.mu.Lock()
+	proc := m.proc
+	m.mu.Unlock()
+	m.procMu.Lock()
+	defer m.procMu.Unlock()
+
+	sample := ResourceSample{Time: time.Now(), PID: proc.Pid}
+	memory, err := proc.MemoryInfo()
+	if err != nil {
+		return sample, err
+	}
+	sample.RSS = memory.RSS
+	if sample.CPU, err = proc.Percent(0); err != nil {
+		return sample, err
+	}
+	if sample.FDs, err = proc.NumFDs(); err != nil {
+		return sample, err
+	}
+	sample.Threads, err = proc.NumThreads()
+	return sample, err
+}
+
+// Stop stops sampling, it's called when the server is closed.
+func (m *ResourceMonitor) Stop() {
+	m.stopOnce.Do(func() { close(m.stop) })
+	<-m.done
+}
+
+// Samples returns the samples recorded so far.
+func (m *ResourceMonitor) Samples() []ResourceSample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]ResourceSample(nil), m.samples...)
+}
+
+// ResetBaseline takes a sample which is the baseline of RequireNoFDLeak from now on, e.g. after
+// WaitForStableFDs on a monitor which has been running since the server started.
+func (m *ResourceMonitor) ResetBaseline(t testing.TB) {
+	sample, err := m.sample()
+	require.NoError(t, err)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.baselineAt = sample.Time
+}
+
+// baseline returns the first sample of the latest process since the baseline was last reset.
+func (m *ResourceMonitor) baseline() (ResourceSample, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.samples) == 0 {
+		return ResourceSample{}, false
+	}
+	baseline := m.samples[len(m.samples)-1]
+	for i := len(m.samples) - 1; i >= 0 && m.samples[i].PID == baseline.PID && !m.samples[i].Time.Before(m.baselineAt); i-- {
+		baseline = m.samples[i]
+	}
+	return baseline, true
+}
+
+// RequireNoFDLeak requires the number of open file descriptors of the server to go back to at most
+// its baseline plus slack within a few seconds, since connections are closed asynchronously.
+func (m *ResourceMonitor) RequireNoFDLeak(t testing.TB, slack int32) {
+	baseline, ok := m.baseline()
+	require.True(t, ok, "no resource sample has been recorded")
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		last, err := m.sample()
+		require.NoError(t, err)
+		if last.PID != baseline.PID || last.FDs <= baseline.FDs+slack {
+			return
+		}
+		if time.Now().After(deadline) {
+			require.Failf(t, "file descriptors leaked", "%d are open at %v and %d at %v", baseline.FDs,
+				baseline.Time.Format(time.StampMilli), last.FDs, last.Time.Format(time.StampMilli))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// RequireRSSBelow requires the resident set size of the server to have stayed below the limit.
+func (m *ResourceMonitor) RequireRSSBelow(t testing.TB, limit uint64) {
+	_, err := m.sample()
+	require.NoError(t, err)
+	for _, sample := range m.Samples() {
+		require.Less(t, sample.RSS, limit, "the RSS is %s at %v, above %s",
+			formatBytes(int64(sample.RSS)), sample.Time.Format(time.StampMilli), formatBytes(int64(limit)))
+	}
+}
+
+// Summary summarizes the samples with the ranges and the last values of the resource usage.
+func (m *ResourceMonitor) Summary() string {
+	samples := m.Samples()
+	if len(samples) == 0 {
+		return "no resource sample has been recorded"
+	}
+	first, last := samples[0], samples[len(samples)-1]
+	minSample, maxSample := first, first
+	var cpu float64
+	for _, sample := range samples {
+		cpu += sample.CPU
+		if sample.RSS < minSample.RSS {
+			minSample.RSS = sample.RSS
+		}
+		if sample.RSS > maxSample.RSS {
+			maxSample.RSS = sample.RSS
+		}
+		if sample.CPU > maxSample.CPU {
+			maxSample.CPU = sample.CPU
+		}
+		if sample.FDs < minSample.FDs {
+			minSample.FDs = sample.FDs
+		}
+		if sample.FDs > maxSample.FDs {
+			maxSample.FDs = sample.FDs
+		}
+		if sample.Threads < minSample.Threads {
+			minSample.Threads = sample.Threads
+		}
+		if sample.Threads > maxSample.Threads {
+			maxSample.Threads = sample.Threads
+		}
+		if sample.DiskUsage < minSample.DiskUsage {
+			minSample.DiskUsage = sample.DiskUsage
+		}
+		if sample.DiskUsage > maxSample.DiskUsage {
+			maxSample.DiskUsage = sample.DiskUsage
+		}
+	}
+	return fmt.Sprintf("%d samples over %v: RSS %s-%s (last %s), CPU max %.1f%% (average %.1f%%), "+
+		"FDs %d-%d (last %d), threads %d-%d (last %d), disk usage %s-%s (last %s)",
+		len(samples), last.Time.Sub(first.Time).Round(time.Millisecond),
+		formatBytes(int64(minSample.RSS)), formatBytes(int64(maxSample.RSS)), formatBytes(int64(last.RSS)),
+		maxSample.CPU, cpu/float64(len(samples)),
+		minSample.FDs, maxSample.FDs, last.FDs,
+		minSample.Threads, maxSample.Threads, last.Threads,
+		formatBytes(minSample.DiskUsage), formatBytes(maxSample.DiskUsage), formatBytes(last.DiskUsage))
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
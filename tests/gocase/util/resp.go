@@ -0,0 +1,358 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ReplyType is the first byte of a reply in the RESP protocol.
+type ReplyType byte
+
+const (
+	ReplySimpleString ReplyType = '+'
+	ReplyError        ReplyType = '-'
+	ReplyInteger      ReplyType = ':'
+	ReplyBulkString   ReplyType = '$'
+	ReplyArray        ReplyType = '*'
+
+	// RESP3 types
+	ReplyNull           ReplyType = '_'
+	ReplyBoolean        ReplyType = '#'
+	ReplyDouble         ReplyType = ','
+	ReplyBigNumber      ReplyType = '('
+	ReplyBlobError      ReplyType = '!'
+	ReplyVerbatimString ReplyType = '='
+	ReplyMap            ReplyType = '%'
+	ReplySet            ReplyType = '~'
+	ReplyAttribute      ReplyType = '|'
+	ReplyPush           ReplyType = '>'
+)
+
+// Reply is a decoded RESP2 or RESP3 reply. Str holds the payload of strings, errors and
+// big numbers, Int holds integers, Float holds doubles and Bool holds booleans. Elems holds
+// the elements of aggregate types, a map is flattened into alternating keys and values.
+// Nil is set for the null bulk string and the null array of RESP2. Format is the format of
+// a verbatim string, e.g. "txt", and Attrs are the attributes sent before the reply.
+type Reply struct {
+	Type   ReplyType
+	Str    string
+	Int    int64
+	Float  float64
+	Bool   bool
+	Format string
+	Elems  []Reply
+	Nil    bool
+	Attrs  []Reply
+}
+
+func SimpleStringReply(s string) Reply {
+	return Reply{Type: ReplySimpleString, Str: s}
+}
+
+func ErrorReply(s string) Reply {
+	return Reply{Type: ReplyError, Str: s}
+}
+
+func IntegerReply(n int64) Reply {
+	return Reply{Type: ReplyInteger, Int: n}
+}
+
+func BulkStringReply(s string) Reply {
+	return Reply{Type: ReplyBulkString, Str: s}
+}
+
+func NilBulkStringReply() Reply {
+	return Reply{Type: ReplyBulkString, Nil: true}
+}
+
+func ArrayReply(elems ...Reply) Reply {
+	if elems == nil {
+		elems = []Reply{}
+	}
+	return Reply{Type: ReplyArray, Elems: elems}
+}
+
+func NilArrayReply() Reply {
+	return Reply{Type: ReplyArray, Nil: true}
+}
+
+func NullReply() Reply {
+	return Reply{Type: ReplyNull}
+}
+
+func BooleanReply(b bool) Reply {
+	return Reply{Type: ReplyBoolean, Bool: b}
+}
+
+func DoubleReply(f float64) Reply {
+	return Reply{Type: ReplyDouble, Float: f}
+}
+
+func MapReply(keyValues ...Reply) Reply {
+	if keyValues == nil {
+		keyValues = []Reply{}
+	}
+	return Reply{Type: ReplyMap, Elems: keyValues}
+}
+
+func SetReply(elems ...Reply) Reply {
+	if elems == nil {
+		elems = []Reply{}
+	}
+	return Reply{Type: ReplySet, Elems: elems}
+}
+
+func PushReply(elems ...Reply) Reply {
+	if elems == nil {
+		elems = []Reply{}
+	}
+	return Reply{Type: ReplyPush, Elems: elems}
+}
+
+// BulkStringsReply is an array of bulk strings, e.g. the reply of LRANGE.
+func BulkStringsReply(ss ...string) Reply {
+	elems := make([]Reply, 0, len(ss))
+	for _, s := range ss {
+		elems = append(elems, BulkStringReply(s))
+	}
+	return ArrayReply(elems...)
+}
+
+// String formats the reply like redis-cli does, which is handy in assertion messages.
+func (r Reply) String() string {
+	var sb strings.Builder
+	r.format(&sb, "")
+	return sb.String()
+}
+
+func (r Reply) format(sb *strings.Builder, indent string) {
+	if r.Nil {
+		sb.WriteString("(nil)")
+		return
+	}
+	switch r.Type {
+	case ReplySimpleString:
+		sb.WriteString(r.Str)
+	case ReplyError, ReplyBlobError:
+		sb.WriteString("(error) " + r.Str)
+	case ReplyInteger:
+		sb.WriteString("(integer) " + strconv.FormatInt(r.Int, 10))
+	case ReplyBulkString, ReplyVerbatimString:
+		sb.WriteString(strconv.Quote(r.Str))
+	case ReplyNull:
+		sb.WriteString("(null)")
+	case ReplyBoolean:
+		sb.WriteString(fmt.Sprintf("(boolean) %v", r.Bool))
+	case ReplyDouble:
+		sb.WriteString("(double) " + strconv.FormatFloat(r.Float, 'g', -1, 64))
+	case ReplyBigNumber:
+		sb.WriteString("(big number) " + r.Str)
+	case ReplyArray, ReplySet, ReplyPush:
+		if len(r.Elems) == 0 {
+			sb.WriteString("(empty array)")
+			return
+		}
+		for i, e := range r.Elems {
+			if i > 0 {
+				sb.WriteString("\n" + indent)
+			}
+			prefix := fmt.Sprintf("%d) ", i+1)
+			sb.WriteString(prefix)
+			e.format(sb, indent+strings.Repeat(" ", len(prefix)))
+		}
+	case ReplyMap:
+		if len(r.Elems) == 0 {
+			sb.WriteString("(empty hash)")
+			return
+		}
+		for i := 0; i+1 < len(r.Elems); i += 2 {
+			if i > 0 {
+				sb.WriteString("\n" + indent)
+			}
+			prefix := fmt.Sprintf("%d# ", i/2+1)
+			sb.WriteString(prefix)
+			r.Elems[i].format(sb, indent+strings.Repeat(" ", len(prefix)))
+			sb.WriteString(" => ")
+			r.Elems[i+1].format(sb, indent+strings.Repeat(" ", len(prefix)))
+		}
+	default:
+		sb.WriteString(fmt.Sprintf("(unknown %q)", byte(r.Type)))
+	}
+}
+
+func readReply(r *bufio.Reader) (Reply, error) {
+	line, err := readReplyLine(r)
+	if err != nil {
+		return Reply{}, err
+	}
+	if len(line) == 0 {
+		return Reply{}, fmt.Errorf("empty reply line")
+	}
+
+	typ, payload := ReplyType(line[0]), line[1:]
+	switch typ {
+	case ReplySimpleString, ReplyError:
+		return Reply{Type: typ, Str: payload}, nil
+	case ReplyInteger:
+		n, err := strconv.ParseInt(payload, 10, 64)
+		if err != nil {
+			return Reply{}, fmt.Errorf("invalid integer reply %q: %w", payload, err)
+		}
+		return IntegerReply(n), nil
+	case ReplyBulkString:
+		n, err := strconv.Atoi(payload)
+		if err != nil || n < -1 {
+			return Reply{}, fmt.Errorf("invalid bulk string length %q", payload)
+		}
+		if n == -1 {
+			return NilBulkStringReply(), nil
+		}
+		s, err := readBulk(r, n)
+		if err != nil {
+			return Reply{}, err
+		}
+		return BulkStringReply(s), nil
+	case ReplyArray:
+		n, err := strconv.Atoi(payload)
+		if err != nil || n < -1 {
+			return Reply{}, fmt.Errorf("invalid array length %q", payload)
+		}
+		if n == -1 {
+			return NilArrayReply(), nil
+		}
+		elems, err := readElems(r, n)
+		if err != nil {
+			return Reply{}, err
+		}
+		return ArrayReply(elems...), nil
+	case ReplyNull:
+		return NullReply(), nil
+	case ReplyBoolean:
+		if payload != "t" && payload != "f" {
+			return Reply{}, fmt.Errorf("invalid boolean reply %q", payload)
+		}
+		return BooleanReply(payload == "t"), nil
+	case ReplyDouble:
+		f, err := parseDouble(payload)
+		if err != nil {
+			return Reply{}, fmt.Errorf("invalid double reply %q: %w", payload, err)
+		}
+		return DoubleReply(f), nil
+	case ReplyBigNumber:
+		if _, ok := new(big.Int).SetString(payload, 10); !ok {
+			return Reply{}, fmt.Errorf("invalid big number reply %q", payload)
+		}
+		return Reply{Type: typ, Str: payload}, nil
+	case ReplyBlobError, ReplyVerbatimString:
+		n, err := strconv.Atoi(payload)
+		if err != nil || n < 0 {
+			return Reply{}, fmt.Errorf("invalid blob length %q", payload)
+		}
+		s, err := readBulk(r, n)
+		if err != nil {
+			return Reply{}, err
+		}
+		if typ == ReplyBlobError {
+			return Reply{Type: typ, Str: s}, nil
+		}
+		if len(s) < 4 || s[3] != ':' {
+			return Reply{}, fmt.Errorf("invalid verbatim string %q", s)
+		}
+		return Reply{Type: typ, Format: s[:3], Str: s[4:]}, nil
+	case ReplyMap, ReplyAttribute, ReplySet, ReplyPush:
+		n, err := strconv.Atoi(payload)
+		if err != nil || n < 0 {
+			return Reply{}, fmt.Errorf("invalid aggregate length %q", payload)
+		}
+		if typ == ReplyMap || typ == ReplyAttribute {
+			n *= 2
+		}
+		elems, err := readElems(r, n)
+		if err != nil {
+			return Reply{}, err
+		}
+		if typ == ReplyAttribute {
+			// attributes are out-of-band data about the reply following them
+			reply, err := readReply(r)
+			if err != nil {
+				return Reply{}, err
+			}
+			reply.Attrs = elems
+			return reply, nil
+		}
+		return Reply{Type: typ, Elems: elems}, nil
+	default:
+		return Reply{}, fmt.Errorf("unknown reply type %q in line %q", byte(typ), line)
+	}
+}
+
+func parseDouble(s string) (float64, error) {
+	switch s {
+	case "inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	case "nan", "-nan":
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func readElems(r *bufio.Reader, n int) ([]Reply, error) {
+	elems := make([]Reply, 0, n)
+	for i := 0; i < n; i++ {
+		e, err := readReply(r)
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, e)
+	}
+	return elems, nil
+}
+
+// readBulk reads a payload of n bytes followed by CRLF, the payload may contain CRLF itself.
+func readBulk(r *bufio.Reader, n int) (string, error) {
+	buf := make([]byte, n+2)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	if buf[n] != '\r' || buf[n+1] != '\n' {
+		return "", fmt.Errorf("bulk string of length %d is not terminated by CRLF", n)
+	}
+	return string(buf[:n]), nil
+}
+
+func readReplyLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasSuffix(line, "\r\n") {
+		return "", fmt.Errorf("reply line %q is not terminated by CRLF", line)
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
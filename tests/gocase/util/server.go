@@ -27,7 +27,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -47,7 +47,14 @@ type KvrocksServer struct {
 
 	configs map[string]string
 
-	clean func(bool)
+	paused bool
+
+	logs *logTailer
+	// startMarker is the end of the logs when the server was last started.
+	startMarker LogMarker
+	monitor     *ResourceMonitor
+
+	clean func()
 }
 
 func (s *KvrocksServer) HostPort() string {
@@ -66,12 +73,14 @@ func (s *KvrocksServer) TLSAddr() string {
 	return s.tlsAddr.String()
 }
 
-func (s *KvrocksServer) LogFileMatches(t testing.TB, pattern string) bool {
-	dir := s.configs["dir"]
-	content, err := os.ReadFile(dir + "/kvrocks.INFO")
-	require.NoError(t, err)
-	p := regexp.MustCompile(pattern)
-	return p.Match(content)
+// Exited reports whether the server process has exited, e.g. it crashed.
+func (s *KvrocksServer) Exited() bool {
+	proc, err := process.NewProcess(int32(s.cmd.Process.Pid))
+	if err != nil {
+		return true
+	}
+	status, err := proc.Status()
+	return err != nil || slices.Contains(status, process.Zombie)
 }
 
 func (s *KvrocksServer) NewClient() *redis.Client {
@@ -101,7 +110,75 @@ func (s *KvrocksServer) Close() {
 	s.close(false)
 }
 
+// ExitStatus tells how the server process exited.
+type ExitStatus struct {
+	// Code is the exit code, or -1 if the process was terminated by a signal.
+	Code int
+	// Signal is the signal which terminated the process, or 0.
+	Signal syscall.Signal
+}
+
+// WaitExit waits for the server process to exit, e.g. after SHUTDOWN or a crash, and returns
+// how it exited. It returns immediately if the process has already been waited for.
+func (s *KvrocksServer) WaitExit() ExitStatus {
+	if s.cmd.ProcessState == nil {
+		// the error only tells that the process didn't exit successfully, which the status covers
+		_ = s.cmd.Wait()
+	}
+	status := s.cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if status.Signaled() {
+		return ExitStatus{Code: -1, Signal: status.Signal()}
+	}
+	return ExitStatus{Code: status.ExitStatus()}
+}
+
+// Kill kills the server process with SIGKILL and waits for it to exit. Unlike Close, the
+// server can't flush anything before exiting, and the data directory is kept, so Restart
+// recovers from an unclean shutdown.
+func (s *KvrocksServer) Kill() {
+	require.NoError(s.t, s.cmd.Process.Kill())
+	require.Equal(s.t, ExitStatus{Code: -1, Signal: syscall.SIGKILL}, s.WaitExit())
+	s.paused = false
+}
+
+// CrashRestart kills the server and starts it again on the same data directory.
+func (s *KvrocksServer) CrashRestart() {
+	s.Kill()
+	s.Restart()
+}
+
+// Pause stops the server process with SIGSTOP, it neither serves clients nor replicates until Resume.
+func (s *KvrocksServer) Pause() {
+	require.NoError(s.t, s.cmd.Process.Signal(syscall.SIGSTOP))
+	s.paused = true
+}
+
+// Resume continues the server process stopped by Pause.
+func (s *KvrocksServer) Resume() {
+	require.NoError(s.t, s.cmd.Process.Signal(syscall.SIGCONT))
+	s.paused = false
+}
+
 func (s *KvrocksServer) close(keepDir bool) {
+	if !keepDir && s.monitor != nil {
+		s.monitor.Stop()
+		s.t.Logf("the resource usage of the server at %s: %s", s.HostPort(), s.monitor.Summary())
+	}
+	failed := !keepDir && s.t.Failed()
+	if failed {
+		s.dumpLogs()
+	}
+	// the process has already been waited for if it was killed or exited on its own
+	if s.cmd.ProcessState != nil {
+		s.clean()
+		return
+	}
+	if s.paused {
+		s.Resume()
+	}
+	if failed {
+		s.saveSnapshot()
+	}
 	require.NoError(s.t, s.cmd.Process.Signal(syscall.SIGTERM))
 	f := func(err error) { require.NoError(s.t, err) }
 	timer := time.AfterFunc(defaultGracePeriod, func() {
@@ -110,22 +187,38 @@ func (s *KvrocksServer) close(keepDir bool) {
 	})
 	defer timer.Stop()
 	f(s.cmd.Wait())
-	s.clean(keepDir)
+	s.clean()
 }
 
 func (s *KvrocksServer) Restart() {
 	s.close(true)
+	s.start()
+}
 
+// RestartWithConfig restarts the server on the same data directory, with the overrides applied
+// to its configuration file. An empty value removes the key, so that its default is used. The
+// address and the directory of the server can't be overridden.
+func (s *KvrocksServer) RestartWithConfig(overrides map[string]string) {
+	for k := range overrides {
+		switch strings.ToLower(k) {
+		case "port", "bind", "dir":
+			require.Failf(s.t, "unsupported override", "%s can't be overridden on a restart", k)
+		}
+	}
+	s.close(true)
+	s.rewriteConfigFile(overrides)
+	s.start()
+}
+
+// start starts the server again with its configuration file.
+func (s *KvrocksServer) start() {
 	b := *binPath
 	require.NotEmpty(s.t, b, "please set the binary path by `-binPath`")
 	cmd := exec.Command(b)
 
 	dir := s.configs["dir"]
-	f, err := os.Open(filepath.Join(dir, "kvrocks.conf"))
-	require.NoError(s.t, err)
-	defer func() { require.NoError(s.t, f.Close()) }()
-
-	cmd.Args = append(cmd.Args, "-c", f.Name())
+	require.FileExists(s.t, s.configFilePath())
+	cmd.Args = append(cmd.Args, "-c", s.configFilePath())
 
 	stdout, err := os.Create(filepath.Join(dir, "stdout"))
 	require.NoError(s.t, err)
@@ -134,6 +227,7 @@ func (s *KvrocksServer) Restart() {
 	require.NoError(s.t, err)
 	cmd.Stderr = stderr
 
+	s.startMarker = s.LogMarker()
 	require.NoError(s.t, cmd.Start())
 
 	c := redis.NewClient(&redis.Options{Addr: s.addr.String()})
@@ -144,12 +238,12 @@ func (s *KvrocksServer) Restart() {
 	}, time.Minute, time.Second)
 
 	s.cmd = cmd
-	s.clean = func(keepDir bool) {
+	if s.monitor != nil {
+		s.monitor.setProcess(s.t, cmd.Process.Pid)
+	}
+	s.clean = func() {
 		require.NoError(s.t, stdout.Close())
 		require.NoError(s.t, stderr.Close())
-		if *deleteOnExit && !keepDir {
-			require.NoError(s.t, os.RemoveAll(dir))
-		}
 	}
 }
 
@@ -188,6 +282,22 @@ func StartServer(t testing.TB, configs map[string]string) *KvrocksServer {
 	require.NoError(t, err)
 	configs["dir"] = dir
 
+	s := &KvrocksServer{
+		t:       t,
+		addr:    addr,
+		configs: configs,
+		logs:    newLogTailer(configs),
+	}
+	// the directory is kept until the end of the test, and archived if the test failed
+	t.Cleanup(func() {
+		if t.Failed() {
+			s.archiveArtifacts(t)
+		}
+		if !t.Failed() || *deleteOnExit {
+			require.NoError(t, os.RemoveAll(dir))
+		}
+	})
+
 	f, err := os.Create(filepath.Join(dir, "kvrocks.conf"))
 	require.NoError(t, err)
 	defer func() { require.NoError(t, f.Close()) }()
@@ -222,19 +332,15 @@ func StartServer(t testing.TB, configs map[string]string) *KvrocksServer {
 	}, time.Minute, time.Second)
 	require.NotContains(t, status, process.Zombie, "Kvrocks has been unexpectedly exited while starting server")
 
-	return &KvrocksServer{
-		t:       t,
-		cmd:     cmd,
-		addr:    addr,
-		configs: configs,
-		clean: func(keepDir bool) {
-			require.NoError(t, stdout.Close())
-			require.NoError(t, stderr.Close())
-			if *deleteOnExit && !keepDir {
-				require.NoError(t, os.RemoveAll(dir))
-			}
-		},
+	s.cmd = cmd
+	s.clean = func() {
+		require.NoError(t, stdout.Close())
+		require.NoError(t, stderr.Close())
+	}
+	if *resourceSampleInterval > 0 {
+		s.MonitorResources(*resourceSampleInterval)
 	}
+	return s
 }
 
 func findFreePort() (*net.TCPAddr, error) {
@@ -19,6 +19,8 @@
 
 package util
 
+import "strings"
+
 // SlotTable is a table of the shortest possible alphanumeric string that is mapped by
 // redis's crc16 to any given redis cluster slot.
 //
@@ -846,3 +848,29 @@ var SlotTable = [...]string{
 	"5F4", "4Ct", "0xZ", "2My", "1L", "0Vv", "4mX", "4x9", "430", "4bY", "0Yw", "zE", "Ti", "03S", "4Lu", "5I5", "60n", "4AE", "L8", "YY",
 	"wu", "0TG", "4oi", "6ZJ",
 }
+
+// SlotOfKey returns the cluster slot of the key, taking hash tags into account.
+func SlotOfKey(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) & (ClusterSlots - 1))
+}
+
+// crc16 implements the CRC16-CCITT (XMODEM) checksum used by redis cluster.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
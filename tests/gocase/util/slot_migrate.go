@@ -0,0 +1,258 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	MigrateStart   = "start"
+	MigrateSuccess = "success"
+	MigrateFail    = "fail"
+
+	ImportStart   = "start"
+	ImportSuccess = "success"
+	ImportError   = "error"
+)
+
+// The allowed transitions of migrating_state and import_state in CLUSTER INFO. A final state
+// is left by the previous migration on the node until the next one starts.
+var migrateTransitions = map[string][]string{
+	"":             {MigrateStart, MigrateSuccess, MigrateFail},
+	MigrateStart:   {MigrateSuccess, MigrateFail},
+	MigrateSuccess: {MigrateStart},
+	MigrateFail:    {MigrateStart},
+}
+
+var importTransitions = map[string][]string{
+	"":            {ImportStart, ImportSuccess, ImportError},
+	ImportStart:   {ImportSuccess, ImportError},
+	ImportSuccess: {ImportStart},
+	ImportError:   {ImportStart},
+}
+
+// SlotMigration drives `clusterx MIGRATE` of a single slot and records the states
+// of the source and the destination observed from CLUSTER INFO.
+type SlotMigration struct {
+	Slot int
+	From *ClusterNode
+	To   *ClusterNode
+
+	// MigrateStates and ImportStates are the distinct states observed in order.
+	MigrateStates []string
+	ImportStates  []string
+
+	cluster *Cluster
+	digest  map[string]string
+}
+
+// MigrateSlot migrates the slot to the given master, requires it to succeed,
+// updates the topology of all nodes and verifies the data of the slot.
+func (c *Cluster) MigrateSlot(slot int, to *ClusterNode) *SlotMigration {
+	m := c.StartMigration(slot, to)
+	require.Equal(c.t, MigrateSuccess, m.Wait(10*time.Second), "failed to migrate slot %d", slot)
+	m.Finish()
+	return m
+}
+
+// StartMigration takes a digest of the slot on its current owner and issues `clusterx MIGRATE`.
+func (c *Cluster) StartMigration(slot int, to *ClusterNode) *SlotMigration {
+	from := c.slots[slot]
+	require.NotNil(c.t, from, "slot %d is not served", slot)
+	require.NotEqual(c.t, from, to, "slot %d is already served by node %s", slot, to.ID)
+
+	m := &SlotMigration{
+		Slot:    slot,
+		From:    from,
+		To:      to,
+		cluster: c,
+		digest:  SlotDigest(c.t, from.Client, slot),
+	}
+	require.Equal(c.t, "OK", from.Client.Do(context.Background(), "clusterx", "MIGRATE", slot, to.ID).Val())
+	return m
+}
+
+// Wait polls CLUSTER INFO of both sides until the source reaches a final state or the
+// timeout expires, and returns the last migrating state of the source.
+func (m *SlotMigration) Wait(timeout time.Duration) string {
+	t := m.cluster.t
+	deadline := time.Now().Add(timeout)
+	for {
+		m.observe()
+		state := m.MigrateState()
+		if state == MigrateSuccess || state == MigrateFail {
+			return state
+		}
+		if time.Now().After(deadline) {
+			require.Failf(t, "migration timeout", "slot %d is still %q after %s", m.Slot, state, timeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (m *SlotMigration) observe() {
+	t := m.cluster.t
+	if state, ok := migratingState(t, m.From.Client, m.Slot); ok {
+		m.MigrateStates = appendState(t, m.MigrateStates, state, migrateTransitions, "migrating")
+	}
+	if state, ok := importingState(t, m.To.Client, m.Slot); ok {
+		m.ImportStates = appendState(t, m.ImportStates, state, importTransitions, "import")
+	}
+}
+
+func appendState(t testing.TB, states []string, state string, transitions map[string][]string, kind string) []string {
+	last := ""
+	if len(states) > 0 {
+		last = states[len(states)-1]
+	}
+	if state == last {
+		return states
+	}
+	require.Contains(t, transitions[last], state, "unexpected %s state transition from %q to %q", kind, last, state)
+	return append(states, state)
+}
+
+// MigrateState returns the latest migrating state observed on the source.
+func (m *SlotMigration) MigrateState() string {
+	if len(m.MigrateStates) == 0 {
+		return ""
+	}
+	return m.MigrateStates[len(m.MigrateStates)-1]
+}
+
+// ImportState returns the latest import state observed on the destination.
+func (m *SlotMigration) ImportState() string {
+	if len(m.ImportStates) == 0 {
+		return ""
+	}
+	return m.ImportStates[len(m.ImportStates)-1]
+}
+
+// Finish assigns the slot to the destination on all nodes after a successful
+// migration, then requires the destination to hold exactly the data of the slot
+// taken before the migration and the source to have dropped it.
+func (m *SlotMigration) Finish() {
+	t := m.cluster.t
+	require.Equal(t, MigrateSuccess, m.MigrateState())
+	require.Eventually(t, func() bool {
+		m.observe()
+		return m.ImportState() == ImportSuccess
+	}, 5*time.Second, 10*time.Millisecond)
+
+	m.cluster.MoveSlots(SlotRange{Start: m.Slot, Stop: m.Slot}, m.To)
+	require.Equal(t, m.digest, SlotDigest(t, m.To.Client, m.Slot), "data of slot %d differs after migration", m.Slot)
+	require.Eventually(t, func() bool {
+		return len(SlotKeys(t, m.From.Client, m.Slot)) == 0
+	}, 5*time.Second, 100*time.Millisecond, "keys of slot %d are left on the source", m.Slot)
+}
+
+func migratingState(t testing.TB, c *redis.Client, slot int) (string, bool) {
+	info := c.ClusterInfo(context.Background()).Val()
+	if !strings.Contains(info, fmt.Sprintf("migrating_slot: %d\r\n", slot)) {
+		return "", false
+	}
+	ms := regexp.MustCompile(`migrating_state: (\w+)`).FindStringSubmatch(info)
+	require.Len(t, ms, 2)
+	return ms[1], true
+}
+
+func importingState(t testing.TB, c *redis.Client, slot int) (string, bool) {
+	info := c.ClusterInfo(context.Background()).Val()
+	if !strings.Contains(info, fmt.Sprintf("importing_slot: %d\r\n", slot)) {
+		return "", false
+	}
+	ms := regexp.MustCompile(`import_state: (\w+)`).FindStringSubmatch(info)
+	require.Len(t, ms, 2)
+	return ms[1], true
+}
+
+// SlotKeys returns all keys of the slot stored on the node.
+func SlotKeys(t testing.TB, c *redis.Client, slot int) []string {
+	keys, err := c.Keys(context.Background(), "*").Result()
+	require.NoError(t, err)
+	var slotKeys []string
+	for _, key := range keys {
+		if SlotOfKey(key) == slot {
+			slotKeys = append(slotKeys, key)
+		}
+	}
+	return slotKeys
+}
+
+// SlotDigest returns the type, the content and whether an expiration is set
+// for every key of the slot stored on the node.
+func SlotDigest(t testing.TB, c *redis.Client, slot int) map[string]string {
+	ctx := context.Background()
+	digest := make(map[string]string)
+	for _, key := range SlotKeys(t, c, slot) {
+		typ, err := c.Type(ctx, key).Result()
+		require.NoError(t, err)
+
+		var value interface{}
+		switch typ {
+		case "string", "bitmap":
+			value, err = c.Get(ctx, key).Result()
+		case "hash":
+			var m map[string]string
+			m, err = c.HGetAll(ctx, key).Result()
+			value = sortedPairs(m)
+		case "list":
+			value, err = c.LRange(ctx, key, 0, -1).Result()
+		case "set":
+			var members []string
+			members, err = c.SMembers(ctx, key).Result()
+			slices.Sort(members)
+			value = members
+		case "zset":
+			value, err = c.ZRangeWithScores(ctx, key, 0, -1).Result()
+		case "sortedint":
+			value, err = c.Do(ctx, "SIRANGE", key, 0, 1<<62).Result()
+		case "stream":
+			value, err = c.XRange(ctx, key, "-", "+").Result()
+		default:
+			require.Fail(t, "unknown type", "key %q has type %q", key, typ)
+		}
+		require.NoError(t, err)
+
+		ttl, err := c.PTTL(ctx, key).Result()
+		require.NoError(t, err)
+		digest[key] = fmt.Sprintf("%s %v expire:%v", typ, value, ttl >= 0)
+	}
+	return digest
+}
+
+func sortedPairs(m map[string]string) []string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, fmt.Sprintf("%q:%q", k, v))
+	}
+	slices.Sort(pairs)
+	return pairs
+}
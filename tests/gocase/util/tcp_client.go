@@ -28,6 +28,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -59,6 +60,11 @@ func (c *TCPClient) Close() error {
 	return c.c.Close()
 }
 
+// SetReadDeadline sets the deadline of the following reads, a zero value disables it.
+func (c *TCPClient) SetReadDeadline(t time.Time) error {
+	return c.c.SetReadDeadline(t)
+}
+
 func (c *TCPClient) ReadLine() (string, error) {
 	r, err := c.r.ReadString('\n')
 	if err != nil {
@@ -87,6 +93,17 @@ func (c *TCPClient) MustReadStrings(t testing.TB, s []string) {
 	}
 }
 
+// ReadReply reads and decodes a whole reply including all nested elements.
+func (c *TCPClient) ReadReply() (Reply, error) {
+	return readReply(c.r)
+}
+
+func (c *TCPClient) MustReadReply(t testing.TB, expected Reply) {
+	r, err := c.ReadReply()
+	require.NoError(t, err)
+	require.Equal(t, expected, r, "expected:\n%s\nactual:\n%s", expected, r)
+}
+
 func (c *TCPClient) MustMatch(t testing.TB, rx string) {
 	r, err := c.ReadLine()
 	require.NoError(t, err)